@@ -0,0 +1,304 @@
+package linep
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrInvalidBundle  = errors.New("InvalidBundle")
+	ErrReplayMismatch = errors.New("ReplayMismatch")
+)
+
+// RecordLimit is the max bytes of stdin, stdout and stderr recorded into a bundle.
+const RecordLimit = 1 << 20
+
+// Bundle is a recorded run to reproduce it.
+type Bundle struct {
+	Time time.Time `yaml:"time"`
+	// CommandLine is the command-line arguments without the command name.
+	CommandLine []string `yaml:"commandLine"`
+	// Config is the effective config of the run.
+	Config   *Config           `yaml:"config"`
+	Template *Template         `yaml:"template"`
+	Args     *ScriptArgs       `yaml:"args"`
+	Shell    []string          `yaml:"shell"`
+	Macros   map[string]string `yaml:"macros"`
+	// Env is the keys of the environment variables of steps from --env-file and --env,
+	// replay passes them from the environment.
+	Env        []string      `yaml:"env"`
+	CleanEnv   bool          `yaml:"cleanEnv"`
+	Cwd        string        `yaml:"cwd"`
+	Check      bool          `yaml:"check"`
+	Duration   time.Duration `yaml:"duration"`
+	ExitStatus int           `yaml:"exitStatus"`
+	// StdinTruncated means Stdin is the head of the input.
+	StdinTruncated  bool `yaml:"stdinTruncated"`
+	StdoutTruncated bool `yaml:"stdoutTruncated"`
+	StderrTruncated bool `yaml:"stderrTruncated"`
+
+	Stdin  []byte `yaml:"-"`
+	Stdout []byte `yaml:"-"`
+	Stderr []byte `yaml:"-"`
+	// Files are the rendered files of the source directory before the run, relative path to content.
+	// They are for reference only, replay renders the files again from Template and Args.
+	Files map[string][]byte `yaml:"-"`
+}
+
+const (
+	bundleManifest = "bundle.yaml"
+	bundleStdin    = "stdin"
+	bundleStdout   = "stdout"
+	bundleStderr   = "stderr"
+	bundleSrcDir   = "src/"
+)
+
+// WriteBundle writes the bundle as a tar file.
+func WriteBundle(name string, b *Bundle) error {
+	manifest, err := yaml.Marshal(b)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := tar.NewWriter(f)
+	add := func(name string, content []byte) error {
+		if err := w.WriteHeader(&tar.Header{
+			Name:    name,
+			Mode:    0644,
+			Size:    int64(len(content)),
+			ModTime: b.Time,
+		}); err != nil {
+			return err
+		}
+		_, err := w.Write(content)
+		return err
+	}
+	for _, x := range []struct {
+		name    string
+		content []byte
+	}{
+		{bundleManifest, manifest},
+		{bundleStdin, b.Stdin},
+		{bundleStdout, b.Stdout},
+		{bundleStderr, b.Stderr},
+	} {
+		if err := add(x.name, x.content); err != nil {
+			return err
+		}
+	}
+	for _, k := range slices.Sorted(maps.Keys(b.Files)) {
+		if err := add(bundleSrcDir+filepath.ToSlash(k), b.Files[k]); err != nil {
+			return err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// ReadBundle reads the tar file written by [WriteBundle].
+func ReadBundle(name string) (*Bundle, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		b     Bundle
+		r     = tar.NewReader(f)
+		found bool
+		files = map[string][]byte{}
+	)
+	for {
+		h, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidBundle, err)
+		}
+		content, err := io.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrInvalidBundle, h.Name, err)
+		}
+		switch h.Name {
+		case bundleManifest:
+			if err := yaml.Unmarshal(content, &b); err != nil {
+				return nil, fmt.Errorf("%w: %s: %w", ErrInvalidBundle, h.Name, err)
+			}
+			found = true
+		case bundleStdin, bundleStdout, bundleStderr:
+			files[h.Name] = content
+		default:
+			if x, ok := strings.CutPrefix(h.Name, bundleSrcDir); ok {
+				files[bundleSrcDir+path.Clean(x)] = content
+			}
+		}
+	}
+	if !found || b.Template == nil || b.Args == nil {
+		return nil, fmt.Errorf("%w: %s is not found", ErrInvalidBundle, bundleManifest)
+	}
+	if len(b.Shell) == 0 {
+		b.Shell = b.Template.ShellCommand()
+	}
+	b.Stdin = files[bundleStdin]
+	b.Stdout = files[bundleStdout]
+	b.Stderr = files[bundleStderr]
+	b.Files = map[string][]byte{}
+	for k, v := range files {
+		if x, ok := strings.CutPrefix(k, bundleSrcDir); ok {
+			b.Files[filepath.FromSlash(x)] = v
+		}
+	}
+	return &b, nil
+}
+
+// limitedBuffer keeps the head of the written bytes up to limit.
+type limitedBuffer struct {
+	bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func newLimitedBuffer(limit int) *limitedBuffer {
+	return &limitedBuffer{limit: limit}
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if rest := b.limit - b.Len(); len(p) > rest {
+		b.truncated = true
+		_, _ = b.Buffer.Write(p[:max(rest, 0)])
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+// record runs like execute and writes the run into the bundle Record.
+func (e *Executor) record(ctx context.Context) error {
+	var (
+		stdin  = newLimitedBuffer(RecordLimit)
+		stdout = newLimitedBuffer(RecordLimit)
+		stderr = newLimitedBuffer(RecordLimit)
+		start  = time.Now()
+	)
+	if e.Stdin != nil {
+		e.Stdin = io.TeeReader(e.Stdin, stdin)
+	}
+	e.Stdout = io.MultiWriter(e.Stdout, stdout)
+	e.Stderr = io.MultiWriter(e.Stderr, stderr)
+
+	err := e.execute(ctx)
+	b := e.bundle
+	if b.Config != nil {
+		c := *b.Config
+		c.Env = RedactEnv(c.Env)
+		c.CommandLine = RedactEnvArgs(c.CommandLine)
+		b.Config = &c
+	}
+	b.Time = start
+	b.CommandLine = RedactEnvArgs(e.CommandLine)
+	b.Template = e.Template
+	b.Args = e.Args
+	b.Shell = e.Shell
+	b.Macros = e.Macros
+	b.Env = RedactEnv(e.Env)
+	b.CleanEnv = e.CleanEnv
+	b.Cwd = e.Cwd
+	b.Check = e.Check
+	b.Duration = time.Since(start)
+	b.ExitStatus = ExitStatus(err)
+	b.Stdin, b.StdinTruncated = stdin.Bytes(), stdin.truncated
+	b.Stdout, b.StdoutTruncated = stdout.Bytes(), stdout.truncated
+	b.Stderr, b.StderrTruncated = stderr.Bytes(), stderr.truncated
+	if x := WriteBundle(e.Record, &b); x != nil {
+		return errors.Join(err, fmt.Errorf("%w: record %s", x, e.Record))
+	}
+	return err
+}
+
+// recordFiles reads the rendered files of the source directory into the bundle, not the outputs of steps.
+func (e Executor) recordFiles(b *Bundle) error {
+	b.Files = map[string][]byte{}
+	if e.tmpDir == "" {
+		return nil
+	}
+	xs, err := listFiles(e.tmpDir)
+	if err != nil {
+		return err
+	}
+	for _, x := range xs {
+		content, err := os.ReadFile(filepath.Join(e.tmpDir, x))
+		if err != nil {
+			return err
+		}
+		b.Files[x] = content
+	}
+	return nil
+}
+
+// Replay runs the bundle again in workDir and pwd, the current directory of the exec cwd.
+// It writes the differences of stdout and the exit status from the recorded ones to w,
+// and returns [ErrReplayMismatch] if they differ.
+func (b Bundle) Replay(ctx context.Context, workDir, pwd string, keep bool, stderr, w io.Writer) error {
+	if b.StdinTruncated {
+		slog.Warn("replay: stdin of the bundle is truncated, the output may differ")
+	}
+	stdout := newLimitedBuffer(RecordLimit)
+	e := &Executor{
+		Shell:      b.Shell,
+		Template:   b.Template,
+		Args:       b.Args,
+		Macros:     b.Macros,
+		Env:        b.Env,
+		CleanEnv:   b.CleanEnv,
+		Cwd:        b.Cwd,
+		Check:      b.Check,
+		ExecPWD:    pwd,
+		WorkDir:    workDir,
+		KeepScript: keep,
+		Stdin:      bytes.NewReader(b.Stdin),
+		Stdout:     stdout,
+		Stderr:     stderr,
+	}
+	defer e.Close()
+	status := ExitStatus(e.Execute(ctx))
+
+	var mismatch bool
+	if status != b.ExitStatus {
+		mismatch = true
+		if _, err := fmt.Fprintf(w, "exit status: recorded %d, replayed %d\n", b.ExitStatus, status); err != nil {
+			return err
+		}
+	}
+	if !bytes.Equal(b.Stdout, stdout.Bytes()) {
+		mismatch = true
+		if err := WriteDiff(w, "recorded stdout", "replayed stdout", b.Stdout, stdout.Bytes()); err != nil {
+			return err
+		}
+	}
+	if mismatch {
+		return ErrReplayMismatch
+	}
+	return nil
+}
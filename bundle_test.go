@@ -0,0 +1,78 @@
+package linep_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/berquerant/linep"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBundle(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "bundle.tar")
+	b := &linep.Bundle{
+		Time:        time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		CommandLine: []string{"py", "print(x)"},
+		Template: &linep.Template{
+			Name:   "py",
+			Main:   "main.py",
+			Script: "print(1)",
+		},
+		Args: &linep.ScriptArgs{
+			Map: "print(x)",
+		},
+		Shell:          []string{"sh"},
+		ExitStatus:     1,
+		StdinTruncated: true,
+		Stdin:          []byte("1\n2\n"),
+		Stdout:         []byte("1\n"),
+		Stderr:         []byte("error\n"),
+		Files: map[string][]byte{
+			"main.py":         []byte("print(1)"),
+			"data/sample.txt": []byte("sample"),
+		},
+	}
+	if !assert.Nil(t, linep.WriteBundle(name, b)) {
+		return
+	}
+	got, err := linep.ReadBundle(name)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.True(t, b.Time.Equal(got.Time))
+	assert.Equal(t, b.CommandLine, got.CommandLine)
+	assert.Equal(t, b.Template.Script, got.Template.Script)
+	assert.Equal(t, b.Args.Map, got.Args.Map)
+	assert.Equal(t, b.Shell, got.Shell)
+	assert.Equal(t, b.ExitStatus, got.ExitStatus)
+	assert.Equal(t, b.StdinTruncated, got.StdinTruncated)
+	assert.Equal(t, b.Stdin, got.Stdin)
+	assert.Equal(t, b.Stdout, got.Stdout)
+	assert.Equal(t, b.Stderr, got.Stderr)
+	assert.Equal(t, b.Files, got.Files)
+
+	t.Run("no shell", func(t *testing.T) {
+		name := filepath.Join(t.TempDir(), "bundle.tar")
+		if !assert.Nil(t, linep.WriteBundle(name, &linep.Bundle{
+			Template: &linep.Template{Name: "sample", Shell: "bash -eu"},
+			Args:     &linep.ScriptArgs{},
+		})) {
+			return
+		}
+		got, err := linep.ReadBundle(name)
+		if assert.Nil(t, err) {
+			assert.Equal(t, []string{"bash", "-eu"}, got.Shell)
+		}
+	})
+
+	t.Run("not a bundle", func(t *testing.T) {
+		name := filepath.Join(t.TempDir(), "bundle.tar")
+		if !assert.Nil(t, os.WriteFile(name, []byte("bundle"), 0644)) {
+			return
+		}
+		_, err := linep.ReadBundle(name)
+		assert.ErrorIs(t, err, linep.ErrInvalidBundle)
+	})
+}
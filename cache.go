@@ -0,0 +1,47 @@
+package linep
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+func cacheRoot(workDir string) string {
+	return filepath.Join(workDir, "cache")
+}
+
+// RemoveCache removes the cache directories in workDir not used within age, all if age is 0.
+// It returns the removed directories.
+func RemoveCache(workDir string, age time.Duration) ([]string, error) {
+	root := cacheRoot(workDir)
+	xs, err := os.ReadDir(root)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var (
+		r     []string
+		limit = time.Now().Add(-age)
+	)
+	for _, x := range xs {
+		if !x.IsDir() {
+			continue
+		}
+		info, err := x.Info()
+		if err != nil {
+			return r, err
+		}
+		if age > 0 && info.ModTime().After(limit) {
+			continue
+		}
+		dir := filepath.Join(root, x.Name())
+		if err := os.RemoveAll(dir); err != nil {
+			return r, err
+		}
+		r = append(r, dir)
+	}
+	return r, nil
+}
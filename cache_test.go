@@ -0,0 +1,42 @@
+package linep_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/berquerant/linep"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemoveCache(t *testing.T) {
+	workDir := t.TempDir()
+	got, err := linep.RemoveCache(workDir, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(got))
+
+	var (
+		old    = filepath.Join(workDir, "cache", "old")
+		recent = filepath.Join(workDir, "cache", "new")
+	)
+	for _, x := range []string{old, recent} {
+		if !assert.Nil(t, os.MkdirAll(x, 0755)) {
+			return
+		}
+	}
+	before := time.Now().Add(-48 * time.Hour)
+	if !assert.Nil(t, os.Chtimes(old, before, before)) {
+		return
+	}
+
+	got, err = linep.RemoveCache(workDir, 24*time.Hour)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{old}, got)
+	_, err = os.Stat(recent)
+	assert.Nil(t, err)
+
+	got, err = linep.RemoveCache(workDir, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{recent}, got)
+}
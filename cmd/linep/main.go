@@ -4,9 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"os/signal"
+	"strings"
+	"time"
 
 	"github.com/berquerant/linep"
 	"github.com/spf13/pflag"
@@ -22,11 +25,100 @@ func failOnError(err error) {
 func main() {
 	fs := pflag.NewFlagSet("main", pflag.ContinueOnError)
 	fs.Usage = func() {
-		fmt.Fprintf(os.Stderr, usage, "linep")
+		fmt.Fprintf(os.Stderr, usage, "linep", strings.Join(linep.CleanEnvAllowlist, ", "), linep.EnvPrefix, linep.ProjectFileName,
+			strings.Join(linep.ReservedMacroEnv, ", "))
 		fs.PrintDefaults()
 	}
 
-	config, err := linep.NewConfig(fs)
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "trust":
+			name, err := linep.TrustProject(fs)
+			if errors.Is(err, pflag.ErrHelp) {
+				return
+			}
+			failOnError(err)
+			fmt.Fprintf(os.Stderr, "trusted %s\n", name)
+			return
+		case "config":
+			if len(os.Args) < 3 || os.Args[2] != "show" {
+				failOnError(errors.New("unknown command: available: config show"))
+			}
+			err := linep.ShowConfig(fs, os.Stdout)
+			if errors.Is(err, pflag.ErrHelp) {
+				return
+			}
+			failOnError(err)
+			return
+		}
+	}
+
+	newConfig := linep.NewConfig
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "save":
+			name, err := linep.SaveSnippet(fs)
+			if errors.Is(err, pflag.ErrHelp) {
+				return
+			}
+			failOnError(err)
+			fmt.Fprintf(os.Stderr, "saved %s\n", name)
+			return
+		case "share":
+			err := linep.Share(fs, os.Stdout)
+			if errors.Is(err, pflag.ErrHelp) {
+				return
+			}
+			failOnError(err)
+			return
+		case "snippets":
+			err := linep.ListSnippets(fs, os.Stdout)
+			if errors.Is(err, pflag.ErrHelp) {
+				return
+			}
+			failOnError(err)
+			return
+		case "run":
+			newConfig = linep.NewSnippetConfig
+		case "export":
+			newConfig = linep.NewExportConfig
+		case "script":
+			newConfig = linep.NewScriptConfig
+		case "replay":
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			err := linep.ReplayBundle(ctx, fs, os.Stdout)
+			stop()
+			if errors.Is(err, pflag.ErrHelp) {
+				return
+			}
+			failOnError(err)
+			fmt.Fprintln(os.Stderr, "replay: stdout and exit status match")
+			return
+		case "cache":
+			if len(os.Args) < 3 || os.Args[2] != "clean" {
+				failOnError(errors.New("unknown command: available: cache clean"))
+			}
+			err := linep.CleanCache(fs, os.Stdout)
+			if errors.Is(err, pflag.ErrHelp) {
+				return
+			}
+			failOnError(err)
+			return
+		case "history":
+			if len(os.Args) > 2 && os.Args[2] == "rerun" {
+				newConfig = linep.NewHistoryConfig
+				break
+			}
+			err := linep.ListHistory(fs, os.Stdout)
+			if errors.Is(err, pflag.ErrHelp) {
+				return
+			}
+			failOnError(err)
+			return
+		}
+	}
+
+	config, err := newConfig(fs)
 	if errors.Is(err, pflag.ErrHelp) {
 		return
 	}
@@ -34,26 +126,56 @@ func main() {
 	config.SetupLogger()
 	slog.Debug("config", "body", fmt.Sprintf("%#v", config), "pflag.args", fmt.Sprintf("%#v", fs.Args()))
 
-	if err := func() error {
+	start := time.Now()
+	err = func() error {
 		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
 		defer stop()
-		e, err := config.Executor(os.Stdin, os.Stdout)
+		var stdin io.Reader = os.Stdin
+		if x := config.Input; x != "" {
+			f, err := os.Open(x)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			stdin = f
+		}
+		e, err := config.Executor(stdin, os.Stdout)
 		if err != nil {
 			return err
 		}
 		defer e.Close()
 		return e.Execute(ctx)
-	}(); err != nil {
-		failOnError(err)
+	}()
+	if x := config.RecordHistory(start, err); x != nil {
+		slog.Warn("record history", "err", fmt.Sprintf("%v", x))
 	}
+	failOnError(err)
 }
 
 const usage = `%[1]s -- process lines by one liner
 
 Usage:
-%[1]s TEMPLATE MAP [FLAGS]
-%[1]s TEMPLATE INIT MAP [FLAGS]
-%[1]s TEMPLATE INIT MAP REDUCE [FLAGS]
+%[1]s TEMPLATE MAP [FLAGS] [-- ARGS...]
+%[1]s TEMPLATE INIT MAP [FLAGS] [-- ARGS...]
+%[1]s TEMPLATE INIT MAP REDUCE [FLAGS] [-- ARGS...]
+%[1]s trust [FILE] [FLAGS]
+%[1]s config show [FLAGS]
+%[1]s save NAME [--description DESC] TEMPLATE ... [FLAGS] [-- ARGS...]
+%[1]s run NAME [key=value...] [FLAGS] [-- ARGS...]
+%[1]s snippets [NAME]
+%[1]s history [QUERY...] [FLAGS]
+%[1]s history rerun ID [FLAGS] [-- ARGS...]
+%[1]s replay BUNDLE [FLAGS]
+%[1]s export DIR TEMPLATE ... [FLAGS] [-- ARGS...]
+%[1]s script FILE [ARGS...]
+%[1]s share TEMPLATE ... [FLAGS] [-- ARGS...]
+%[1]s cache clean [DURATION] [FLAGS]
+
+ARGS are passed to the script as arguments.
+INIT, MAP and REDUCE can be @path to read the code from the file, @@ at the head means a literal @.
+They can be also read by --init-file, --map-file and --reduce-file.
+TEMPLATE can be omitted if the code files have the extension: .go, .py or .rs.
+Locations of the generated script in errors are rewritten into INIT, MAP and REDUCE like "MAP line 2, col 5".
 
 TEMPLATE: go, py, python, pipenv, rs, rust, nil, null, empty
 
@@ -91,6 +213,36 @@ Examples:
 # is almost equivalent to
 > seq 3 | %[1]s py 'print(x+"0")'
 
+# additional dependencies
+> seq 3 | %[1]s go 'var g errgroup.Group;g.Go(func() error{fmt.Println(x+"0");return nil});g.Wait()' --import 'golang.org/x/sync/errgroup' --dep 'golang.org/x/sync@v0.18.0' -q
+10
+20
+30
+
+# code from files
+> cat map.py
+if x.startswith("#"):
+    print(x)
+> %[1]s py @map.py --input data.txt
+> %[1]s --map-file map.py --input data.txt
+> cat map.py | %[1]s py --map-file - --input data.txt
+
+# script arguments
+> seq 3 | %[1]s py 'n=int(sys.argv[1])' 'print(int(x)*n)' -q -- 10
+10
+20
+30
+
+# check the generated script without input
+> %[1]s go 'fmt.Printf("%%d\n", x)' --check
+main.go:13:15: fmt.Printf format %%d has arg x of wrong type string
+
+# run in the current directory
+> echo data.csv | %[1]s py 'print(open(x).readline())' --cwd exec
+
+# environment variables of steps
+> %[1]s py 'print(os.environ["GREETING"])' --import os --env GREETING=hello --env-file .env --clean-env
+
 # indent MAP (python)
 > %[1]s py 'r={}' 'x=x.split(".")[-1]
 if x in r:
@@ -115,8 +267,15 @@ except BrokenPipeError:
 for k, v in r.items():
   print(f"{k}\t{v}")
 
+# display the steps to run with expanded commands, the keys of the environment and the directories, without writing files
+> %[1]s go 'fmt.Println(x)' --plan
+> %[1]s go 'fmt.Println(x)' --plan --json
+
+# format the generated script, highlighted if stdout is a terminal
+> %[1]s go 'fmt.Println(x)' --dry --fmt
+
 Templates:
-TEMPLATE argument can be a template filename.
+TEMPLATE argument can be a template filename, NAME of NAME.yml or NAME.yaml in --template-path, or data:... of share.
 empty (nil, null) template is for overriding.
 A template file format is:
 
@@ -135,30 +294,297 @@ alias:
 #   Map    : MAP argument (string)
 #   Reduce : REDUCE argument (string)
 #   Import : --import argument (slice of string)
+#   Dep    : --dep argument (slice of string)
+#   Args   : ARGS after -- (slice of string)
+# Init, Map and Reduce are normalized:
+# leading and trailing blank lines and the common leading whitespace of lines are removed.
+# errors are mapped to Init, Map and Reduce unless they are changed by functions like goQuote.
+# additional functions:
+#   reindent  : indent each line by n spaces with a newline at the head like {{ .Map | reindent 4 }}
+#   goQuote   : quote a string as a Go string literal
+#   pyQuote   : quote a string as a Python string literal
+#   rustQuote : quote a string as a Rust string literal
+#   shQuote   : quote a string as a shell word
 script: |
   ...
 # init script command.
 # initialize a directory of generated script like 'go mod init'.
+# executed by text/template with the same fields as script before macros are replaced,
+# macros in the values of the fields like ARGS are not replaced.
+# additional functions for shell (also available in script):
+#   shQuote : quote a string as a shell word
+#   shJoin  : quote each of a slice of string as a shell word and join them by space
+# e.g. {{ with .Import }}pip install {{ shJoin . }}{{ end }}
 # macros are replaced with a reference of an environment variable.
 # available macros:
 #   @MAIN     : main of this template
 #   @WORK_DIR : --workDir argument
 #   @EXEC_PWD : current directory of %[1]s execution
 #   @SRC_DIR  : directory of the generated script
+#   @CACHE_DIR : directory shared by runs with the same sources and deps, for cached steps
+#   @BINARY   : executable of export --binary, available in binary
+#   @NAME     : additional macro defined by macros or --macro NAME=value
+#               NAME should not be a reserved environment variable like PATH
+# @@ is replaced with @.
 init: |
   ...
 # execute script command.
-# execute generated script like 'go run @MAIN'.
-# macros are available.
+# execute generated script like 'go run @MAIN {{ shJoin .Args }}'.
+# text/template and macros are available.
 exec: |
   ...
+# language of the script: go, python or rust.
+# dependencies are written into the manifest of the language before init:
+#   go     : go.mod
+#   python : requirements.txt
+#   rust   : Cargo.toml
+lang: go
+# dependencies of the script.
+# --dep argument adds dependencies.
+# formats:
+#   go     : module@version
+#   python : pip requirement specifier like 'requests>=2'
+#   rust   : crate=version or crate, version can be an inline table like '{version="1",features=["derive"]}'
+deps:
+  - ...
+# additional macros, name to value.
+# --macro argument overrides them.
+macros:
+  NAME: value
+# expand macros in the script too, default is false.
+expandScript: false
+# auxiliary files in the directory of the generated script, filename to template.
+# executed by text/template as well as script.
+files:
+  data/sample.txt: |
+    ...
+# inherit a template, builtin template name or template filename.
+# relative filename is resolved from the directory of this template file.
+# fields of this template overwrite the inherited ones, maps like macros and files are merged.
+extends: go
+# lifecycle of the script, default is init and exec.
+# steps run in order.
+steps:
+    # step name, required.
+    # empty run of init and exec is init and exec of this template.
+  - name: init
+  - name: build
+    # script command, text/template and macros are available.
+    run: go build -o @CACHE_DIR/main @MAIN
+    # attach: attach stdin, stdout and stderr (default of exec)
+    # stderr: redirect stdout to stderr, no stdin (default)
+    # quiet : hide outputs unless failed
+    stdio: quiet
+    # success: run if all previous steps succeeded (default)
+    # failure: run if some previous step failed
+    # always : run regardless of previous steps
+    when: success
+    # skip if succeeded before with the same sources and run.
+    cache: true
+  - name: exec
+    run: "@CACHE_DIR/main"
+  - name: cleanup
+    run: ...
+    when: always
+# working directory of the exec step, default is src.
+# --cwd argument overrides it.
+#   src  : directory of the generated script, @SRC_DIR
+#   exec : current directory of %[1]s execution, @EXEC_PWD
+# exec should refer to files in the directory of the generated script by @SRC_DIR in exec cwd.
+cwd: src
+# check script command.
+# check the generated script like 'go vet ./...' by --check.
+# steps before the exec step run before check, stdin is not attached.
+# text/template and macros are available.
+check: |
+  ...
+# build the executable @BINARY by export --binary like 'go build -o @BINARY @MAIN'.
+# text/template and macros are available.
+binary: |
+  ...
+# format script command.
+# format the generated script from stdin to stdout like 'gofmt' by --dry --fmt.
+# it runs in the current directory, text/template and macros are available.
+fmt: gofmt
+# convert tabs in the indentation of INIT, MAP and REDUCE into spaces if positive.
+tabWidth: 4
+# shell to execute steps, default is sh.
+# --sh argument overrides it.
+shell: bash -euo pipefail
+# additional environment variables of steps.
+# values can refer to environment variables like $HOME.
+# macros override them.
+env:
+  PYTHONUNBUFFERED: "1"
+  CARGO_TERM_QUIET: "true"
+
+# override fields of the template
+> %[1]s go 'fmt.Println(x)' --template-set 'exec=go run -race @MAIN' --template-set 'macros.NAME=value' --template-patch patch.yml
 
 # show template
 > %[1]s go --displayTemplate
 
-Environment variables:
-You can use the flag name with the hyphen removed and converted to uppercase as an environment variable.
-If both the corresponding flag and the environment variable are specified at the same time, the flag takes precedence.
+Environment variables of steps:
+The environment of %[1]s, or allowlisted ones if --clean-env, is overridden by
+env of the template, macros, --env-file, --env and builtin macros in order.
+Allowlist of --clean-env: %[2]s
+Macro names of the allowlist and %[5]s are reserved.
+
+Snippets:
+'save' saves the arguments as a snippet NAME into snippets.yaml in the directory of the default config file.
+'run' runs the snippet NAME, FLAGS and ARGS are added to the arguments of the snippet.
+Placeholders @{key} and @{key:default} in the arguments of the snippet are replaced with the values of key=value.
+'snippets' lists the snippets with their descriptions, or displays the snippet NAME.
+snippets in the config file and the project file are also available, the latter takes precedence.
+
+> %[1]s save upper --description 'convert case' go 'fmt.Println(strings.To@{case:Upper}(x))' --import strings
+> echo abc | %[1]s run upper
+ABC
+> echo ABC | %[1]s run upper case=Lower
+abc
+> %[1]s snippets
+upper  convert case
+
+Cache:
+@CACHE_DIR is a directory under cache in the workdir, shared by runs with the same sources and deps.
+They are not removed by %[1]s, 'cache clean' removes the ones not used within DURATION like 168h, all if omitted.
+
+> %[1]s cache clean 168h
+
+History:
+Runs are recorded into history.jsonl in the workdir with the template, the arguments, the imports,
+the duration and the exit status, except --no-history, --dry, --plan and --displayTemplate.
+Values of --env are not recorded, 'history rerun' passes them from the environment.
+history.jsonl is rotated into history.jsonl.1 when it exceeds 4 MiB, and invalid lines of them are skipped.
+'history' lists the runs: ID, time, exit status, duration and the command line, in JSON by --json.
+QUERY filters the runs whose command line or directory contains all of the words, ignoring case.
+'history rerun' runs ID again in the directory of the run, FLAGS and ARGS are added to the arguments of the run.
+
+> %[1]s history strings
+12  2026-01-02 15:04:05  0  1.234s  %[1]s go 'fmt.Println(strings.ToUpper(x))' --import strings
+> %[1]s history rerun 12 --import os
+
+Bundles:
+--record BUNDLE records the run into a tar file to reproduce it:
+  bundle.yaml : the command line, the effective config, the resolved template, INIT, MAP, REDUCE,
+                the shell, macros, keys of environment variables of --env-file and --env, duration and exit status
+  stdin       : the head of stdin
+  stdout      : the head of stdout
+  stderr      : the head of stderr of steps, recorded even if --quiet
+  src/        : the rendered files of the directory of the generated script like the script and the manifest,
+                for reference only since 'replay' renders them again
+Each of stdin, stdout and stderr is recorded up to 1 MiB.
+Values of --env-file and --env are not recorded, 'replay' passes them from the environment.
+'replay' runs BUNDLE again with the recorded stdin and writes the diff of stdout and the exit status.
+It fails if they differ. stderr is recorded for reference only since it contains temporary paths.
+
+> seq 3 | %[1]s py 'print(int(x)*2)' --record bundle.tar
+> %[1]s replay bundle.tar
+replay: stdout and exit status match
+
+Export:
+'export' writes the generated script and the auxiliary files into DIR as a standalone project, with README.md and Makefile.
+The steps before the exec step run in DIR, and DIR is @SRC_DIR, @WORK_DIR and the parent of @CACHE_DIR.
+Makefile has a target of each step, exec is the default, macros and environment variables are its variables.
+ARGS are the variable ARGS of Makefile, and values of --env-file and --env are passed from the environment of make.
+--binary OUT builds the executable OUT by binary of the template, go and rust have it.
+--record is not available with export.
+
+> %[1]s export upper go 'fmt.Println(strings.ToUpper(x))' --import strings --binary upper/upper
+> seq 3 | make -s -C upper
+> seq 3 | make -s -C upper ARGS='a b'
+> seq 3 | upper/upper
+
+Script files:
+'script' runs FILE with ARGS passed to the script, FILE can be executable by the shebang.
+FILE starts with the YAML frontmatter of the template and flags, followed by sections of INIT, MAP and REDUCE.
+TEMPLATE can be omitted if FILE has the extension: .go, .py or .rs.
+TEMPLATE like ./tool or tool.yml, a path rather than a name, is resolved from the directory of FILE.
+Flags of the frontmatter are the same as the config file, relative paths of template-path, template-patch,
+input, init-file, map-file, reduce-file and env-file are resolved from the directory of FILE.
+
+> cat bin/prod
+#!/usr/bin/env -S %[1]s script
+---
+template: py
+import:
+  - math
+quiet: true
+--- init
+acc = []
+--- map
+acc.append(int(x) * int(sys.argv[1]))
+--- reduce
+print(math.prod(acc))
+> seq 4 | bin/prod 2
+384
+
+Share:
+'share' writes a single shell command to run on another machine with %[1]s, without files to copy.
+The template, merged with --template-patch and --template-set, is encoded into TEMPLATE as data:...
+unless it is a builtin template without changes. The code of files is inlined.
+Flags of the config file, the project file and the environment variables are included,
+except --input and --env-file. Only the keys of --env are included, the values are passed from the environment.
+
+> %[1]s share mytemplate.yml 'print(x)' --template-set 'env.GREETING=hello'
+%[1]s data:H4sIAAAAAAAC_... 'print(x)'
+
+Config:
+Flags are also read from the config file and the environment variables.
+The precedence order is, the latter takes precedence:
+  1. defaults
+  2. config file
+  3. profile of the config file
+  4. project file
+  5. profile of the project file
+  6. environment variables
+  7. flags
+Flags that can be specified multiple times like --env accumulate values in this order.
+
+The config file is --config, default is $XDG_CONFIG_HOME/linep/config.yaml or $HOME/.config/linep/config.yaml.
+It is the flag names to values:
+# default values of flags.
+quiet: true
+# lists of flags separated by '|' or ';' like --import.
+import:
+  - strings
+# flags that can be specified multiple times.
+env:
+  - PYTHONUNBUFFERED=1
+# profile used if --profile is not specified.
+profile: fast
+# snippets, same format as snippets.yaml.
+snippets:
+  upper:
+    description: convert case
+    args:
+      - go
+      - fmt.Println(strings.To@{case:Upper}(x))
+      - --import
+      - strings
+# named values override the default values, selected by --profile.
+profiles:
+  fast:
+    keep: true
+  ci:
+    clean-env: true
+    sh:
+      - bash
+      - -euo
+      - pipefail
+
+The project file %[4]s is found from the current directory to the root, and is merged after the profile of the config file.
+It is the same format as the config file except profile, and should be trusted by 'trust' before use.
+An untrusted project file is skipped with a warning.
+'trust' trusts the current content of FILE, default is the project file, and it should be trusted again after it is changed.
+The trust covers FILE and the templates in the directories of its template-path,
+but not the other files like template-patch, init-file, env-file and the templates extended from outside of template-path.
+The relative paths of template-path in the config file and the project file are resolved from the directory of the file.
+
+The environment variable of a flag is the flag name with hyphens replaced with underscores,
+converted to uppercase and prefixed by %[3]s like %[3]sWORKDIR, %[3]sTEMPLATE_SET.
+
+'config show' displays the values of the flags and their sources, in JSON by --json.
 
 Flags:
 `
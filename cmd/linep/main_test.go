@@ -2,14 +2,18 @@ package main_test
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"testing"
 
+	"github.com/berquerant/linep"
 	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
 )
 
 func TestEndToEnd(t *testing.T) {
@@ -57,13 +61,68 @@ script: |
   }`)
 	})
 
+	extendsTemplate := filepath.Join(t.TempDir(), "extends.yml")
+	t.Run("prepare extends template", func(t *testing.T) {
+		f, err := os.Create(extendsTemplate)
+		if err != nil {
+			t.Error(err)
+		}
+		defer f.Close()
+		fmt.Fprintln(f, `extends: go
+name: extends
+files:
+  data/header.txt: |
+    {{ "header" | upper }}`)
+	})
+
+	envFile := filepath.Join(t.TempDir(), "env")
+	t.Run("prepare env file", func(t *testing.T) {
+		f, err := os.Create(envFile)
+		if err != nil {
+			t.Error(err)
+		}
+		defer f.Close()
+		fmt.Fprintln(f, `# comment
+export FROM_FILE="file"
+GREETING=overridden`)
+	})
+	codeDir := t.TempDir()
+	mapFile := filepath.Join(codeDir, "map.py")
+	dataFile := filepath.Join(codeDir, "data.txt")
+	t.Run("prepare code files", func(t *testing.T) {
+		if err := os.WriteFile(mapFile, []byte(`print(x+"0")`), 0644); err != nil {
+			t.Error(err)
+		}
+		if err := os.WriteFile(dataFile, []byte("1\n2\n3\n"), 0644); err != nil {
+			t.Error(err)
+		}
+	})
+	configDir := t.TempDir()
+	t.Run("prepare config file", func(t *testing.T) {
+		if err := os.MkdirAll(filepath.Join(configDir, "linep"), 0755); err != nil {
+			t.Error(err)
+		}
+		if err := os.WriteFile(filepath.Join(configDir, "linep", "config.yaml"), []byte(`profiles:
+  upper:
+    import:
+      - strings
+`), 0644); err != nil {
+			t.Error(err)
+		}
+	})
+	t.Setenv("XDG_CONFIG_HOME", configDir)
+	t.Setenv("LINEP_TEST_SECRET", "secret")
+	t.Setenv("LINEP_TEST_PASS", "pass")
+	t.Setenv("GOOGLE_TEST_KEY", "key")
+
 	const workDir = ".linep"
 
 	for _, tc := range []struct {
-		title string
-		input string
-		args  []string
-		want  string
+		title   string
+		input   string
+		args    []string
+		want    string
+		wantErr bool
 	}{
 		{
 			title: "custom",
@@ -102,6 +161,40 @@ script: |
 				`os|pathlib as p`,
 			},
 			want: `True
+`,
+		},
+		{
+			title: "go dep",
+			input: `1
+2
+3`,
+			args: []string{
+				"go",
+				`var g errgroup.Group;g.Go(func() error{fmt.Println(x+"0");return nil});g.Wait()`,
+				"--import",
+				"golang.org/x/sync/errgroup",
+				"--dep",
+				"golang.org/x/sync@v0.18.0",
+			},
+			want: `10
+20
+30
+`,
+		},
+		{
+			title: "rust dep",
+			input: `1
+2
+3`,
+			args: []string{
+				"rust",
+				`let n: i32 = x.parse().unwrap();let mut b = itoa::Buffer::new();println!("{}0", b.format(n));`,
+				"--dep",
+				"itoa=1",
+			},
+			want: `10
+20
+30
 `,
 		},
 		{
@@ -220,6 +313,349 @@ script: |
 30
 `,
 		},
+		{
+			title: "render exec",
+			input: ``,
+			args: []string{
+				"empty",
+				`for a in "$@"; do echo "$a"; done`,
+				"--exec", "sh @MAIN {{ shJoin .Import }}",
+				"--script", `{{.Map}}`,
+				"--import", `a b|c'd`,
+			},
+			want: `a b
+c'd
+`,
+		},
+		{
+			title: "macro",
+			input: ``,
+			args: []string{
+				"empty",
+				`echo "$1" "$2" @MAIN`,
+				"--exec", "sh @MAIN @GREETING @@MAIN",
+				"--script", `{{.Map}}`,
+				"--macro", "GREETING=hello world",
+			},
+			want: `hello world @MAIN @MAIN
+`,
+		},
+		{
+			title: "extends",
+			input: `1
+2
+3`,
+			args: []string{
+				extendsTemplate,
+				`fmt.Println(x+"0")`,
+				"--template-set", "exec=cat data/header.txt && go run @MAIN",
+				"--template-set", "macros.UNUSED=value",
+			},
+			want: `HEADER
+10
+20
+30
+`,
+		},
+		{
+			title: "steps",
+			input: `1
+2
+3`,
+			args: []string{
+				"go",
+				`fmt.Println(x+"0")`,
+				"--template-set",
+				`steps=[{name: init}, {name: build, run: "go build -o @CACHE_DIR/main @MAIN && echo built", stdio: quiet, cache: true}, {name: exec, run: "@CACHE_DIR/main"}, {name: failed, run: "echo failed", stdio: attach, when: failure}, {name: done, run: "echo done", stdio: attach, when: always}]`,
+			},
+			want: `10
+20
+30
+done
+`,
+		},
+		{
+			title: "shell and env",
+			input: ``,
+			args: []string{
+				"empty",
+				`echo "${GREETING}" && [ "${EXPANDED}" = "${PATH}" ] && echo expanded`,
+				"--exec", `[ -n "${BASH_VERSION}" ] && echo bash && sh @MAIN`,
+				"--script", `{{.Map}}`,
+				"--template-set", "shell=bash -eu",
+				"--template-set", "env.GREETING=hello",
+				"--template-set", "env.EXPANDED=$PATH",
+			},
+			want: `bash
+hello
+expanded
+`,
+		},
+		{
+			title: "clean env",
+			input: ``,
+			args: []string{
+				"empty",
+				`echo "${GREETING} ${FROM_FILE} ${LINEP_TEST_SECRET:-none} ${LINEP_TEST_PASS} ${GOOGLE_TEST_KEY:-none}"`,
+				"--exec", "sh @MAIN",
+				"--script", `{{.Map}}`,
+				"--clean-env",
+				"--env-file", envFile,
+				"--env", "GREETING=hello",
+				"--env", "LINEP_TEST_PASS",
+			},
+			want: `hello file none pass none
+`,
+		},
+		{
+			title: "env overrides macros",
+			input: ``,
+			args: []string{
+				"empty",
+				`echo "${GREETING} $1 $2"`,
+				"--exec", "sh @MAIN @GREETING @FAREWELL",
+				"--script", `{{.Map}}`,
+				"--template-set", "macros.GREETING=template",
+				"--macro", "FAREWELL=macro",
+				"--env", "GREETING=env",
+			},
+			want: `env env macro
+`,
+		},
+		{
+			title: "py args",
+			input: `1
+2`,
+			args: []string{
+				"py",
+				`n=int(sys.argv[1])`,
+				`print(int(x)*n)`,
+				`print(sys.argv[2:])`,
+				"--",
+				"10",
+				"error x",
+			},
+			want: `10
+20
+['error x']
+`,
+		},
+		{
+			title: "go args",
+			input: ``,
+			args: []string{
+				"go",
+				`fmt.Printf("%q\n", os.Args[1:])`,
+				`_ = x`,
+				"--",
+				"-q",
+				"it's",
+			},
+			want: `["-q" "it's"]
+`,
+		},
+		{
+			title: "py cwd exec",
+			input: `main_test.go`,
+			args: []string{
+				"py",
+				`with open(x) as f:
+  print(f.readline().rstrip())`,
+				"--cwd", "exec",
+			},
+			want: `package main_test
+`,
+		},
+		{
+			title: "go cwd exec",
+			input: `main_test.go`,
+			args: []string{
+				"go",
+				`b, _ := os.ReadFile(x);fmt.Println(strings.SplitN(string(b), "\n", 2)[0])`,
+				"--cwd", "exec",
+				"--import", "strings",
+			},
+			want: `package main_test
+`,
+		},
+		{
+			title: "rust cwd exec",
+			input: `main_test.go`,
+			args: []string{
+				"rust",
+				`println!("{}", std::fs::read_to_string(&x).unwrap().lines().next().unwrap());`,
+				"--cwd", "exec",
+			},
+			want: `package main_test
+`,
+		},
+		{
+			title: "map file",
+			input: `1
+2
+3`,
+			args: []string{
+				"--map-file", mapFile,
+			},
+			want: `10
+20
+30
+`,
+		},
+		{
+			title: "map file arg",
+			input: `1
+2
+3`,
+			args: []string{
+				"py",
+				"@" + mapFile,
+			},
+			want: `10
+20
+30
+`,
+		},
+		{
+			title: "map file stdin",
+			input: `print(x+"1")`,
+			args: []string{
+				"py",
+				"--map-file", "-",
+				"--input", dataFile,
+			},
+			want: `11
+21
+31
+`,
+		},
+		{
+			title: "py dedent",
+			input: `1
+2`,
+			args: []string{
+				"py",
+				"\n\tacc = []\n",
+				"\n    n = int(x)\n    if n % 2 == 0:\n\t\tacc.append(n)\n",
+				"        print(acc)",
+			},
+			want: `[2]
+`,
+		},
+		{
+			title: "go dedent",
+			input: `1
+2`,
+			args: []string{
+				"go",
+				"\t\tif x == \"2\" {\n\t\t\tfmt.Println(x)\n\t\t}",
+			},
+			want: `2
+`,
+		},
+		{
+			title: "profile",
+			input: `a
+b`,
+			args: []string{
+				"go",
+				`fmt.Println(strings.ToUpper(x))`,
+				"--profile",
+				"upper",
+			},
+			want: `A
+B
+`,
+		},
+		{
+			title: "py args with macros",
+			input: `1`,
+			args: []string{
+				"py",
+				`print(sys.argv[1:])`,
+				"--",
+				"a@@b",
+				"@MAIN",
+				"x@WORK_DIR",
+			},
+			want: `['a@@b', '@MAIN', 'x@WORK_DIR']
+`,
+		},
+		{
+			title: "py macros in template actions",
+			input: `1`,
+			args: []string{
+				"py",
+				`print(x, sys.argv[1:])`,
+				"--template-set", `exec={{ with .Args }}{{ printf "python %s %s" "@MAIN" (shJoin .) }}{{ end }}`,
+				"--cwd", "src",
+				"--",
+				"a@b",
+			},
+			want: `1 ['a@b']
+`,
+		},
+		{
+			title: "go dry fmt",
+			args: []string{
+				"go",
+				`fmt.Println(x)`,
+				"--dry",
+				"--fmt",
+			},
+			want: `package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+)
+
+func main() {
+	__scanner := bufio.NewScanner(os.Stdin)
+	for __scanner.Scan() {
+		x := __scanner.Text()
+		fmt.Println(x)
+	}
+	if err := __scanner.Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
+`,
+		},
+		{
+			title: "go check",
+			input: `1`,
+			args: []string{
+				"go",
+				`fmt.Println(x)`,
+				"--check",
+			},
+			want: ``,
+		},
+		{
+			title: "go check error",
+			input: `1`,
+			args: []string{
+				"go",
+				`fmt.Printf("%d\n", x)`,
+				"--check",
+			},
+			want:    ``,
+			wantErr: true,
+		},
+		{
+			title: "py check error",
+			input: `1`,
+			args: []string{
+				"py",
+				`print(x`,
+				"--check",
+			},
+			want:    ``,
+			wantErr: true,
+		},
 	} {
 		t.Run(tc.title, func(t *testing.T) {
 			t.Logf("run: %v", tc.args)
@@ -228,10 +664,285 @@ script: |
 
 			args := []string{"--workDir", workDir}
 			args = append(args, tc.args...)
-			assert.Nil(t, run(&stdout, stdin, e.cmd, args...))
+			err := run(&stdout, stdin, e.cmd, args...)
+			if tc.wantErr {
+				assert.NotNil(t, err)
+			} else {
+				assert.Nil(t, err)
+			}
 			assert.Equal(t, tc.want, stdout.String())
 		})
 	}
+
+	t.Run("snippet", func(t *testing.T) {
+		if err := run(io.Discard, nil, e.cmd,
+			"save", "case", "--description", "convert case",
+			"go", `fmt.Println(strings.To@{case:Upper}(x))`, "--import", "strings", "--workDir", workDir,
+		); !assert.Nil(t, err) {
+			return
+		}
+		for _, tc := range []struct {
+			title string
+			args  []string
+			want  string
+		}{
+			{
+				title: "default",
+				args:  []string{"run", "case"},
+				want:  "AB\n",
+			},
+			{
+				title: "value",
+				args:  []string{"run", "case", "case=Lower"},
+				want:  "ab\n",
+			},
+			{
+				title: "list",
+				args:  []string{"snippets"},
+				want:  "case  convert case\n",
+			},
+		} {
+			t.Run(tc.title, func(t *testing.T) {
+				var stdout bytes.Buffer
+				err := run(&stdout, bytes.NewBufferString("aB"), e.cmd, append(tc.args, "--workDir", workDir)...)
+				assert.Nil(t, err)
+				assert.Equal(t, tc.want, stdout.String())
+			})
+		}
+	})
+
+	t.Run("untrusted project", func(t *testing.T) {
+		dir := t.TempDir()
+		if !assert.Nil(t, os.WriteFile(filepath.Join(dir, linep.ProjectFileName), []byte("dry: true\n"), 0644)) {
+			return
+		}
+		t.Chdir(dir)
+		var stdout bytes.Buffer
+		err := run(&stdout, bytes.NewBufferString("a"), e.cmd, "py", "print(x)", "--workDir", t.TempDir())
+		assert.Nil(t, err)
+		assert.Equal(t, "a\n", stdout.String())
+	})
+
+	t.Run("config show", func(t *testing.T) {
+		var (
+			configDir  = t.TempDir()
+			projectDir = t.TempDir()
+			workDir    = t.TempDir()
+			configFile = filepath.Join(configDir, "linep", "config.yaml")
+			project    = filepath.Join(projectDir, linep.ProjectFileName)
+		)
+		if !assert.Nil(t, os.MkdirAll(filepath.Dir(configFile), 0755)) {
+			return
+		}
+		if !assert.Nil(t, os.WriteFile(configFile, []byte(`quiet: true
+profiles:
+  p:
+    cwd: exec
+    env:
+      - A=profile
+`), 0644)) {
+			return
+		}
+		if !assert.Nil(t, os.WriteFile(project, []byte(`dry: true
+env:
+  - B=project
+`), 0644)) {
+			return
+		}
+		t.Setenv("XDG_CONFIG_HOME", configDir)
+		t.Setenv("LINEP_KEEP", "true")
+		t.Chdir(projectDir)
+		if !assert.Nil(t, run(io.Discard, nil, e.cmd, "trust", "--workDir", workDir)) {
+			return
+		}
+
+		want := map[string]linep.ConfigValue{
+			"check":   {Value: false, Source: "default"},
+			"quiet":   {Value: true, Source: "config file " + configFile},
+			"cwd":     {Value: "exec", Source: "profile p of config file " + configFile},
+			"dry":     {Value: true, Source: "project file " + project},
+			"keep":    {Value: true, Source: "environment variable LINEP_KEEP"},
+			"profile": {Value: "p", Source: "flags"},
+			"env": {
+				Value:  []any{"A=profile", "B=project", "C=flag"},
+				Source: "profile p of config file " + configFile + ", project file " + project + ", flags",
+			},
+		}
+		args := []string{"config", "show", "--profile", "p", "--env", "C=flag", "--workDir", workDir}
+		for _, tc := range []struct {
+			title     string
+			args      []string
+			unmarshal func([]byte, any) error
+		}{
+			{title: "yaml", unmarshal: yaml.Unmarshal},
+			{title: "json", args: []string{"--json"}, unmarshal: json.Unmarshal},
+		} {
+			t.Run(tc.title, func(t *testing.T) {
+				var stdout bytes.Buffer
+				if !assert.Nil(t, run(&stdout, nil, e.cmd, append(args, tc.args...)...)) {
+					return
+				}
+				var got map[string]linep.ConfigValue
+				if !assert.Nil(t, tc.unmarshal(stdout.Bytes(), &got)) {
+					return
+				}
+				for k, v := range want {
+					assert.Equal(t, v, got[k], k)
+				}
+			})
+		}
+	})
+
+	t.Run("history", func(t *testing.T) {
+		workDir := t.TempDir()
+		t.Setenv("HISTORY_SECRET", "secret")
+		if err := run(io.Discard, bytes.NewBufferString("aB"), e.cmd,
+			"go", `fmt.Println(strings.Repeat(x, 2))`, "--import", "strings", "--workDir", workDir,
+			"--env", "HISTORY_SECRET=secret",
+		); !assert.Nil(t, err) {
+			return
+		}
+		var stdout bytes.Buffer
+		if err := run(&stdout, nil, e.cmd, "history", "strings.Repeat", "--json", "--workDir", workDir); !assert.Nil(t, err) {
+			return
+		}
+		var xs []linep.HistoryEntry
+		if !assert.Nil(t, json.Unmarshal(stdout.Bytes(), &xs)) || !assert.Equal(t, 1, len(xs)) {
+			return
+		}
+		assert.Equal(t, 0, xs[0].ExitStatus)
+		assert.Equal(t, []string{"strings"}, xs[0].Import)
+		assert.Equal(t, "HISTORY_SECRET", xs[0].Args[len(xs[0].Args)-1])
+
+		stdout.Reset()
+		err := run(&stdout, bytes.NewBufferString("c"), e.cmd, "history", "rerun", strconv.Itoa(xs[0].ID), "--workDir", workDir)
+		assert.Nil(t, err)
+		assert.Equal(t, "cc\n", stdout.String())
+	})
+
+	t.Run("record", func(t *testing.T) {
+		bundle := filepath.Join(t.TempDir(), "bundle.tar")
+		t.Setenv("RECORD_SUFFIX", "0")
+		var stdout bytes.Buffer
+		if err := run(&stdout, bytes.NewBufferString("1\n2\n"), e.cmd,
+			"go", `fmt.Println(x+os.Getenv("RECORD_SUFFIX"))`, "--import", "os", "--env", "RECORD_SUFFIX=0",
+			"--record", bundle, "--workDir", workDir,
+		); !assert.Nil(t, err) {
+			return
+		}
+		assert.Equal(t, "10\n20\n", stdout.String())
+		b, err := linep.ReadBundle(bundle)
+		if !assert.Nil(t, err) {
+			return
+		}
+		assert.Equal(t, []string{"RECORD_SUFFIX"}, b.Env)
+		assert.Equal(t, []string{"RECORD_SUFFIX"}, b.Config.Env)
+		_, ok := b.Files["main.go"]
+		assert.True(t, ok)
+		assert.Equal(t, 1, len(b.Files))
+
+		stdout.Reset()
+		assert.Nil(t, run(&stdout, nil, e.cmd, "replay", bundle, "--workDir", workDir))
+		assert.Equal(t, "", stdout.String())
+	})
+
+	t.Run("export", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "upper")
+		binary := filepath.Join(dir, "bin", "upper")
+		if err := run(io.Discard, nil, e.cmd,
+			"export", dir, "go", `fmt.Println(strings.ToUpper(x))`, "--import", "strings", "--binary", binary, "--workDir", workDir,
+		); !assert.Nil(t, err) {
+			return
+		}
+		for _, x := range []string{"Makefile", "README.md", "main.go", "go.mod"} {
+			_, err := os.Stat(filepath.Join(dir, x))
+			assert.Nil(t, err, x)
+		}
+		var stdout bytes.Buffer
+		assert.Nil(t, run(&stdout, bytes.NewBufferString("ab\n"), binary))
+		assert.Equal(t, "AB\n", stdout.String())
+	})
+
+	t.Run("export record", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "record")
+		assert.NotNil(t, run(io.Discard, nil, e.cmd,
+			"export", dir, "py", "print(x)", "--record", filepath.Join(t.TempDir(), "bundle.tar"), "--workDir", workDir,
+		))
+	})
+
+	t.Run("export args", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "argv")
+		if err := run(io.Discard, nil, e.cmd,
+			"export", dir, "py", `print(os.environ["EXPORT_SECRET"], sys.argv[1:])`, "--import", "os",
+			"--env", "EXPORT_SECRET=secret", "--workDir", workDir, "--", "a b",
+		); !assert.Nil(t, err) {
+			return
+		}
+		b, err := os.ReadFile(filepath.Join(dir, "Makefile"))
+		if !assert.Nil(t, err) {
+			return
+		}
+		assert.False(t, bytes.Contains(b, []byte("secret")))
+
+		t.Setenv("EXPORT_SECRET", "from make")
+		for _, tc := range []struct {
+			title string
+			args  []string
+			want  string
+		}{
+			{title: "default", want: "from make ['a b']\n"},
+			{title: "ARGS", args: []string{"ARGS='c d' e"}, want: "from make ['c d', 'e']\n"},
+		} {
+			t.Run(tc.title, func(t *testing.T) {
+				var stdout bytes.Buffer
+				assert.Nil(t, run(&stdout, bytes.NewBufferString("x\n"), "make", append([]string{"-s", "-C", dir}, tc.args...)...))
+				assert.Equal(t, tc.want, stdout.String())
+			})
+		}
+	})
+
+	t.Run("script", func(t *testing.T) {
+		name := filepath.Join(t.TempDir(), "prod")
+		if err := os.WriteFile(name, []byte(`#!/usr/bin/env -S linep script
+---
+template: go
+import:
+  - strconv
+--- init
+acc := 1
+n, _ := strconv.Atoi(os.Args[1])
+--- map
+v, _ := strconv.Atoi(x)
+acc *= v * n
+--- reduce
+fmt.Println(acc)
+`), 0755); !assert.Nil(t, err) {
+			return
+		}
+		// ARGS are passed to the script
+		t.Setenv("LINEP_WORKDIR", workDir)
+		var stdout bytes.Buffer
+		err := run(&stdout, bytes.NewBufferString("1\n2\n3\n"), e.cmd, "script", name, "2")
+		assert.Nil(t, err)
+		assert.Equal(t, "48\n", stdout.String())
+	})
+
+	t.Run("share", func(t *testing.T) {
+		var stdout bytes.Buffer
+		if err := run(&stdout, nil, e.cmd,
+			"share", "py", `print(os.environ["GREETING"], x)`, "--import", "os", "--template-set", "env.GREETING=hello", "--workDir", workDir,
+		); !assert.Nil(t, err) {
+			return
+		}
+		// run the command without files
+		t.Setenv("PATH", filepath.Dir(e.cmd)+string(os.PathListSeparator)+os.Getenv("PATH"))
+		t.Setenv("LINEP_WORKDIR", workDir)
+		cmd := stdout.String()
+		stdout.Reset()
+		err := run(&stdout, bytes.NewBufferString("x\n"), "sh", "-c", cmd)
+		assert.Nil(t, err)
+		assert.Equal(t, "hello x\n", stdout.String())
+	})
 }
 
 func run(w io.Writer, r io.Reader, name string, arg ...string) error {
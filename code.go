@@ -0,0 +1,133 @@
+package linep
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	ErrInvalidCode = errors.New("InvalidCode")
+)
+
+// templateNameByExt is the builtin template name for the file extension of the code file.
+var templateNameByExt = map[string]string{
+	".go": "go",
+	".py": "python",
+	".rs": "rust",
+}
+
+// TemplateNameFromFilename returns the builtin template name for the file extension.
+func TemplateNameFromFilename(name string) (string, bool) {
+	x, ok := templateNameByExt[filepath.Ext(name)]
+	return x, ok
+}
+
+// codeLoader loads INIT, MAP and REDUCE from files.
+type codeLoader struct {
+	// stdin is available for code if data is not from stdin.
+	stdin     io.Reader
+	usedStdin bool
+	// files are the code filenames loaded.
+	files []string
+}
+
+// file reads the code file, - means stdin.
+func (l *codeLoader) file(name string) (string, error) {
+	if name != "-" {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			return "", err
+		}
+		l.files = append(l.files, name)
+		return string(b), nil
+	}
+	if l.stdin == nil {
+		return "", fmt.Errorf("%w: stdin is data, use --input to read code from stdin", ErrInvalidCode)
+	}
+	if l.usedStdin {
+		return "", fmt.Errorf("%w: stdin is read already", ErrInvalidCode)
+	}
+	l.usedStdin = true
+	b, err := io.ReadAll(l.stdin)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// arg reads the code file if the positional argument is @path.
+// @@ at the head means a literal @; an argument with newlines is code.
+func (l *codeLoader) arg(s string) (string, error) {
+	switch {
+	case strings.HasPrefix(s, "@@"):
+		return s[1:], nil
+	case strings.HasPrefix(s, "@") && !strings.Contains(s, "\n"):
+		return l.file(s[1:])
+	default:
+		return s, nil
+	}
+}
+
+// codeArg escapes the code as a positional argument not to read a file.
+func codeArg(s string) string {
+	if strings.HasPrefix(s, "@") {
+		return "@" + s
+	}
+	return s
+}
+
+// load sets the code from the positional argument and the file flag to dst.
+func (l *codeLoader) load(dst *string, flagName, file string) error {
+	x, err := l.arg(*dst)
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, *dst)
+	}
+	*dst = x
+	if file == "" {
+		return nil
+	}
+	if *dst != "" {
+		return fmt.Errorf("%w: both positional argument and --%s are specified", ErrInvalidCode, flagName)
+	}
+	if *dst, err = l.file(file); err != nil {
+		return fmt.Errorf("%w: --%s %s", err, flagName, file)
+	}
+	return nil
+}
+
+// loadCode loads INIT, MAP and REDUCE from --init-file, --map-file, --reduce-file and @path positional arguments.
+// If the template is not specified, it is selected by the file extension of the code files.
+func (c *Config) loadCode(stdin io.Reader) error {
+	l := &codeLoader{}
+	if c.Input != "" {
+		l.stdin = stdin
+	}
+	for _, x := range []struct {
+		dst      *string
+		flagName string
+		file     string
+	}{
+		{dst: &c.Init, flagName: "init-file", file: c.InitFile},
+		{dst: &c.Map, flagName: "map-file", file: c.MapFile},
+		{dst: &c.Reduce, flagName: "reduce-file", file: c.ReduceFile},
+	} {
+		if err := l.load(x.dst, x.flagName, x.file); err != nil {
+			return err
+		}
+	}
+
+	if c.TemplateName != "" {
+		return nil
+	}
+	for _, f := range l.files {
+		if x, ok := TemplateNameFromFilename(f); ok {
+			c.TemplateName = x
+			return nil
+		}
+	}
+	return nil
+}
@@ -8,48 +8,101 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
-	"slices"
 	"strings"
+	"time"
 
 	"github.com/berquerant/structconfig"
-	"gopkg.in/yaml.v3"
 )
 
 var (
-	errUnexpectedType  = errors.New("UnexpectedType")
 	errUnexpectedField = errors.New("UnexpectedField")
 )
 
 type Config struct {
+	ConfigFile      string   `json:"config" yaml:"config" name:"config" usage:"config file; default: $XDG_CONFIG_HOME/linep/config.yaml or $HOME/.config/linep/config.yaml"`
+	Profile         string   `json:"profile" yaml:"profile" name:"profile" usage:"profile of the config file; default: profile of the config file"`
 	Dry             bool     `json:"dry" yaml:"dry" name:"dry" usage:"do not run; display generated script"`
+	Fmt             bool     `json:"fmt" yaml:"fmt" name:"fmt" usage:"format the generated script by fmt of the template with --dry"`
 	Debug           bool     `json:"debug" yaml:"debug" name:"debug" usage:"enable debug logs"`
 	Quiet           bool     `json:"quiet" yaml:"quiet" name:"quiet" short:"q" usage:"quiet stderr logs"`
 	Keep            bool     `json:"keep" yaml:"keep" name:"keep" usage:"keep generated script directory"`
 	WorkDir         string   `json:"workDir" yaml:"workDir" name:"workDir" short:"w" usage:"working directory; default: $HOME/.linep"`
-	Shell           []string `json:"sh" yaml:"sh" name:"sh" default:"sh" usage:"execute shell command; separated by ';'"`
+	Shell           []string `json:"sh" yaml:"sh" name:"sh" usage:"execute shell command; separated by ';'; default: shell of the template or sh"`
 	TemplateName    string   `json:"name" yaml:"name"`
 	TemplateScript  string   `json:"tscript" yaml:"tscript" name:"script" usage:"override script"`
 	TemplateInit    string   `json:"tinit" yaml:"tinit" name:"init" usage:"override init script"`
 	TemplateExec    string   `json:"texec" yaml:"texec" name:"exec" usage:"override exec script"`
 	TemplateMain    string   `json:"tmain" yaml:"tmain" name:"main" usage:"override main script name"`
+	TemplateSet     []string `json:"tset" yaml:"tset"`
+	TemplatePatch   []string `json:"tpatch" yaml:"tpatch"`
+	TemplatePath    []string `json:"tpath" yaml:"tpath"`
 	Init            string   `json:"init" yaml:"init"`
 	Map             string   `json:"map" yaml:"map"`
 	Reduce          string   `json:"reduce" yaml:"reduce"`
+	Args            []string `json:"args" yaml:"args"`
+	InitFile        string   `json:"initFile" yaml:"initFile" name:"init-file" usage:"read INIT from the file; - means stdin, requires --input"`
+	MapFile         string   `json:"mapFile" yaml:"mapFile" name:"map-file" usage:"read MAP from the file; - means stdin, requires --input"`
+	ReduceFile      string   `json:"reduceFile" yaml:"reduceFile" name:"reduce-file" usage:"read REDUCE from the file; - means stdin, requires --input"`
+	Input           string   `json:"input" yaml:"input" name:"input" usage:"read data from the file instead of stdin"`
 	Import          []string `json:"import" yaml:"import" name:"import" short:"i" usage:"additional libraries; separated by '|'"`
+	Macro           []string `json:"macro" yaml:"macro" name:"macro" usage:"additional macros NAME=value; separated by '|'"`
+	Dep             []string `json:"dep" yaml:"dep" name:"dep" usage:"additional dependencies written into the manifest; separated by '|'"`
+	Env             []string `json:"env" yaml:"env"`
+	EnvFile         []string `json:"envFile" yaml:"envFile"`
+	Cwd             string   `json:"cwd" yaml:"cwd" name:"cwd" usage:"working directory of the exec step; src: directory of the script, exec: current directory; default: cwd of the template or src"`
+	CleanEnv        bool     `json:"cleanEnv" yaml:"cleanEnv" name:"clean-env" usage:"pass only allowlisted environment variables like PATH, HOME and toolchain ones to steps"`
 	PWD             string   `json:"pwd" yaml:"pwd"`
+	Check           bool     `json:"check" yaml:"check" name:"check" usage:"do not run; run init and check of the template without stdin"`
 	DisplayTemplate bool     `json:"displayTemplate" yaml:"displayTemplate" name:"displayTemplate" usage:"do not run; display template"`
+	Plan            bool     `json:"plan" yaml:"plan" name:"plan" usage:"do not run; display the steps with expanded commands, the keys of the environment, the shell and the directories"`
+	JSON            bool     `json:"json" yaml:"json" name:"json" usage:"display --plan, config show and history in JSON"`
+	NoHistory       bool     `json:"noHistory" yaml:"noHistory" name:"no-history" usage:"do not record the run into the history"`
+	Record          string   `json:"record" yaml:"record" name:"record" usage:"record the run into the bundle tar file to reproduce it by replay"`
+	Binary          string   `json:"binary" yaml:"binary" name:"binary" usage:"build the executable by binary of the template with export"`
+	// Export is DIR of export.
+	Export string `json:"export" yaml:"export"`
+	// CommandLine is the command-line arguments without the command name.
+	CommandLine []string `json:"commandLine" yaml:"commandLine"`
 }
 
 func (c *Config) Initialize() error {
-	if c.WorkDir == "" {
+	x, err := absWorkDir(c.WorkDir)
+	if err != nil {
+		return err
+	}
+	c.WorkDir = x
+
+	return nil
+}
+
+// absWorkDir returns the absolute path of the workdir, default is $HOME/.linep.
+func absWorkDir(dir string) (string, error) {
+	if dir == "" {
 		x, err := os.UserHomeDir()
 		if err != nil {
-			return err
+			return "", err
 		}
-		c.WorkDir = filepath.Join(x, ".linep")
+		dir = filepath.Join(x, ".linep")
 	}
+	// macros like SRC_DIR should be available in any directory
+	return filepath.Abs(dir)
+}
 
-	return nil
+// RecordHistory appends the run started at start and ended with err to the history in the workdir.
+// It does nothing if --no-history or the run only displays something.
+func (c Config) RecordHistory(start time.Time, err error) error {
+	if c.NoHistory || c.Dry || c.Plan || c.DisplayTemplate || c.Export != "" {
+		return nil
+	}
+	return AppendHistory(c.WorkDir, HistoryEntry{
+		Time:       start,
+		Dir:        c.PWD,
+		Template:   c.TemplateName,
+		Args:       RedactEnvArgs(c.CommandLine),
+		Import:     c.Import,
+		Duration:   time.Since(start),
+		ExitStatus: ExitStatus(err),
+	})
 }
 
 func (c Config) Executor(stdin io.Reader, stdout io.Writer) (*Executor, error) {
@@ -57,23 +110,72 @@ func (c Config) Executor(stdin io.Reader, stdout io.Writer) (*Executor, error) {
 	if err != nil {
 		return nil, err
 	}
+	macros, err := ParseMacros(c.Macro)
+	if err != nil {
+		return nil, err
+	}
+	env, err := c.env()
+	if err != nil {
+		return nil, err
+	}
+	if err := ValidateCwd(c.Cwd); err != nil {
+		return nil, err
+	}
+	if c.Binary != "" && c.Export == "" {
+		return nil, fmt.Errorf("%w: --binary requires export", ErrExport)
+	}
 	return &Executor{
-		Shell:           c.Shell,
+		Shell:           c.shell(t),
 		Template:        t,
 		Args:            c.SciprtArgs(),
+		Macros:          macros,
+		Env:             env,
+		CleanEnv:        c.CleanEnv,
+		Cwd:             c.Cwd,
+		Check:           c.Check,
 		ExecPWD:         c.PWD,
 		WorkDir:         c.WorkDir,
 		KeepScript:      c.Keep,
 		Dry:             c.Dry,
+		Fmt:             c.Fmt,
 		DisplayTemplate: c.DisplayTemplate,
+		Plan:            c.Plan,
+		JSON:            c.JSON,
+		Record:          c.Record,
+		Export:          c.Export,
+		Binary:          c.Binary,
+		CommandLine:     c.CommandLine,
 		Stdin:           stdin,
 		Stdout:          stdout,
 		Stderr:          Stderr(c.Quiet),
+		bundle: Bundle{
+			Config: &c,
+		},
 	}, nil
 }
 
 func (c Config) Template() (*Template, error) {
-	t, err := c.selectTemplate()
+	d, err := loadTemplateDoc(c.TemplateName, c.TemplatePath)
+	if err != nil {
+		return nil, fmt.Errorf("%w: load template %s", err, c.TemplateName)
+	}
+	for _, p := range c.TemplatePatch {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("%w: template patch", err)
+		}
+		x, err := parseTemplateDoc(b)
+		if err != nil {
+			return nil, fmt.Errorf("%w: template patch %s", err, p)
+		}
+		d.Merge(x)
+	}
+	for _, x := range c.TemplateSet {
+		if err := d.Set(x); err != nil {
+			return nil, err
+		}
+	}
+	t, err := d.Template()
 	if err != nil {
 		return nil, err
 	}
@@ -89,34 +191,30 @@ func (c Config) Template() (*Template, error) {
 	return t, nil
 }
 
-func (c Config) selectTemplate() (*Template, error) {
-	x, ok := builtinTemplates.get(c.TemplateName)
-	if !ok {
-		x, err := c.loadTemplate()
+// env returns environment variables from --env-file and --env, the latter takes precedence.
+func (c Config) env() ([]string, error) {
+	var r []string
+	for _, f := range c.EnvFile {
+		x, err := ReadEnvFile(f)
 		if err != nil {
-			return nil, fmt.Errorf("%w: load template %s", err, c.TemplateName)
+			return nil, fmt.Errorf("%w: env file %s", err, f)
 		}
-		return x, nil
-	}
-	return x, nil
-}
-
-func (c Config) loadTemplate() (*Template, error) {
-	f, err := os.Open(c.TemplateName)
-	if err != nil {
-		return nil, err
+		r = append(r, x...)
 	}
-	defer f.Close()
-	b, err := io.ReadAll(f)
-	if err != nil {
-		return nil, err
+	for _, x := range c.Env {
+		if err := ValidateEnv(x); err != nil {
+			return nil, err
+		}
+		r = append(r, x)
 	}
+	return r, nil
+}
 
-	var t Template
-	if err := yaml.Unmarshal(b, &t); err != nil {
-		return nil, err
+func (c Config) shell(t *Template) []string {
+	if len(c.Shell) > 0 {
+		return c.Shell
 	}
-	return &t, nil
+	return t.ShellCommand()
 }
 
 func (c Config) SciprtArgs() *ScriptArgs {
@@ -125,6 +223,8 @@ func (c Config) SciprtArgs() *ScriptArgs {
 		Map:    c.Map,
 		Reduce: c.Reduce,
 		Import: c.Import,
+		Dep:    c.Dep,
+		Args:   c.Args,
 	}
 }
 
@@ -132,17 +232,13 @@ func (c Config) SetupLogger() {
 	SetupLogger(c.Debug, c.Quiet)
 }
 
-func (Config) equalCallback(a, b any) (bool, error) {
-	switch a := a.(type) {
-	case []string:
-		b, ok := b.([]string)
-		if !ok {
-			return false, nil
-		}
-		return slices.Equal(a, b), nil
-	default:
-		return false, fmt.Errorf("%w: %#v, %#v", errUnexpectedType, a, b)
-	}
+// listSeparators are the separators of the flags of lists.
+var listSeparators = map[string]string{
+	"sh":     ";",
+	"alias":  ";",
+	"import": "|",
+	"dep":    "|",
+	"macro":  "|",
 }
 
 func (c Config) unmarshalCallback(f structconfig.StructField, v string, fv func() reflect.Value) error {
@@ -150,22 +246,15 @@ func (c Config) unmarshalCallback(f structconfig.StructField, v string, fv func(
 	if !ok {
 		return nil
 	}
-	switch name {
-	case "sh", "alias":
-		if v == "" {
-			return nil
-		}
-		fv().Set(reflect.ValueOf(strings.Split(v, ";")))
-		return nil
-	case "import":
-		if v == "" {
-			return nil
-		}
-		fv().Set(reflect.ValueOf(strings.Split(v, "|")))
-		return nil
-	default:
+	sep, ok := listSeparators[name]
+	if !ok {
 		return fmt.Errorf("%w: %s=%s", errUnexpectedField, name, v)
 	}
+	if v == "" {
+		return nil
+	}
+	fv().Set(reflect.ValueOf(strings.Split(v, sep)))
+	return nil
 }
 
 func (c Config) StructConfig() *structconfig.StructConfig[Config] {
@@ -173,10 +262,3 @@ func (c Config) StructConfig() *structconfig.StructConfig[Config] {
 		structconfig.WithAnyCallback(c.unmarshalCallback),
 	)
 }
-
-func (c Config) Merger() *structconfig.Merger[Config] {
-	return structconfig.NewMerger[Config](
-		structconfig.WithAnyCallback(c.unmarshalCallback),
-		structconfig.WithAnyEqual(c.equalCallback),
-	)
-}
@@ -0,0 +1,211 @@
+package linep
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrInvalidConfigFile = errors.New("InvalidConfigFile")
+)
+
+// EnvPrefix is the prefix of the environment variables of flags.
+const EnvPrefix = "LINEP_"
+
+// EnvName returns the environment variable of the flag,
+// the flag name with hyphens replaced with underscores and converted to uppercase, prefixed by [EnvPrefix].
+func EnvName(flagName string) string {
+	return EnvPrefix + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(flagName))
+}
+
+// DefaultConfigFile returns $XDG_CONFIG_HOME/linep/config.yaml, default XDG_CONFIG_HOME is $HOME/.config.
+func DefaultConfigFile() (string, error) {
+	if x := os.Getenv("XDG_CONFIG_HOME"); x != "" {
+		return filepath.Join(x, "linep", "config.yaml"), nil
+	}
+	x, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(x, ".config", "linep", "config.yaml"), nil
+}
+
+// ConfigFile is the config file, flag names to values.
+type ConfigFile struct {
+	// Profile is the profile selected if --profile is not specified.
+	Profile string `yaml:"profile"`
+	// Profiles are named sets of values overriding Values.
+	Profiles map[string]map[string]any `yaml:"profiles"`
+	// Snippets are merged into the snippets of the snippets file.
+	Snippets Snippets       `yaml:"snippets"`
+	Values   map[string]any `yaml:",inline"`
+	// dir is the directory of the file, relative template paths are resolved from it.
+	dir string
+}
+
+// ReadConfigFile reads the config file.
+// It returns an empty config if the file does not exist and it is not required.
+func ReadConfigFile(name string, required bool) (*ConfigFile, error) {
+	b, err := os.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) && !required {
+		return &ConfigFile{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseConfigFile(name, b)
+}
+
+func parseConfigFile(name string, b []byte) (*ConfigFile, error) {
+	var c ConfigFile
+	if err := yaml.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidConfigFile, err)
+	}
+	c.dir = filepath.Dir(name)
+	return &c, nil
+}
+
+// valueArgs returns the values as flag arguments.
+func (c ConfigFile) valueArgs(fs *pflag.FlagSet) ([]string, error) {
+	return flagArgs(fs, c.Values, c.dir)
+}
+
+// profileArgs returns the values of the profile as flag arguments.
+// It returns false if the profile is not found.
+func (c ConfigFile) profileArgs(fs *pflag.FlagSet, profile string) ([]string, bool, error) {
+	values, ok := c.Profiles[profile]
+	if !ok {
+		return nil, false, nil
+	}
+	if _, ok := values["profile"]; ok {
+		return nil, false, fmt.Errorf("%w: profile %s: profile in profile", ErrInvalidConfigFile, profile)
+	}
+	x, err := flagArgs(fs, values, c.dir)
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: profile %s", err, profile)
+	}
+	return x, true, nil
+}
+
+// flagArgs converts flag names to values into flag arguments like --name=value.
+// A list is joined by the separator of the flag, or repeated if the flag can be specified multiple times.
+// Relative template paths are resolved from dir.
+func flagArgs(fs *pflag.FlagSet, values map[string]any, dir string) ([]string, error) {
+	var r []string
+	for _, k := range slices.Sorted(maps.Keys(values)) {
+		f := fs.Lookup(k)
+		if f == nil || k == "config" {
+			return nil, fmt.Errorf("%w: unknown key: %s", ErrInvalidConfigFile, k)
+		}
+		v := values[k]
+		if k == "template-path" {
+			v = resolvePaths(v, dir)
+		}
+		switch v := v.(type) {
+		case nil:
+		case []any:
+			xs := make([]string, len(v))
+			for i, x := range v {
+				xs[i] = fmt.Sprint(x)
+			}
+			if sep, ok := listSeparators[k]; ok {
+				r = append(r, fmt.Sprintf("--%s=%s", k, strings.Join(xs, sep)))
+				continue
+			}
+			if f.Value.Type() != "stringArray" {
+				return nil, fmt.Errorf("%w: %s: should not be a list", ErrInvalidConfigFile, k)
+			}
+			for _, x := range xs {
+				r = append(r, fmt.Sprintf("--%s=%s", k, x))
+			}
+		case map[string]any:
+			return nil, fmt.Errorf("%w: %s: should not be a map", ErrInvalidConfigFile, k)
+		default:
+			r = append(r, fmt.Sprintf("--%s=%v", k, v))
+		}
+	}
+	return r, nil
+}
+
+// resolvePaths resolves the relative paths of v, a path or a list of paths, from dir.
+// - means stdin and is not resolved.
+func resolvePaths(v any, dir string) any {
+	resolve := func(x any) any {
+		if s, ok := x.(string); ok && dir != "" && s != "" && s != "-" && !filepath.IsAbs(s) {
+			return filepath.Join(dir, s)
+		}
+		return x
+	}
+	if xs, ok := v.([]any); ok {
+		r := make([]any, len(xs))
+		for i, x := range xs {
+			r[i] = resolve(x)
+		}
+		return r
+	}
+	return resolve(v)
+}
+
+// ProjectFileName is the name of the project file.
+const ProjectFileName = ".linep.yaml"
+
+// FindProjectFile finds the project file from dir to the root.
+func FindProjectFile(dir string) (string, bool) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", false
+	}
+	for {
+		x := filepath.Join(dir, ProjectFileName)
+		if info, err := os.Stat(x); err == nil && info.Mode().IsRegular() {
+			return x, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// ReadProjectFile reads the project file if it is trusted in workDir.
+func ReadProjectFile(workDir, name string) (*ConfigFile, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := IsTrusted(workDir, name, b)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: %s, run 'linep trust %s' after reviewing it", ErrUntrusted, name, name)
+	}
+	c, err := parseConfigFile(name, b)
+	if err != nil {
+		return nil, err
+	}
+	if c.Profile != "" {
+		return nil, fmt.Errorf("%w: profile is not available in the project file", ErrInvalidConfigFile)
+	}
+	return c, nil
+}
+
+// envArgs returns the environment variables of the flags as flag arguments.
+func envArgs(fs *pflag.FlagSet) []string {
+	var r []string
+	fs.VisitAll(func(f *pflag.Flag) {
+		if x, ok := os.LookupEnv(EnvName(f.Name)); ok {
+			r = append(r, fmt.Sprintf("--%s=%s", f.Name, x))
+		}
+	})
+	return r
+}
@@ -0,0 +1,84 @@
+package linep_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/berquerant/linep"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvName(t *testing.T) {
+	assert.Equal(t, "LINEP_DRY", linep.EnvName("dry"))
+	assert.Equal(t, "LINEP_WORKDIR", linep.EnvName("workDir"))
+	assert.Equal(t, "LINEP_TEMPLATE_SET", linep.EnvName("template-set"))
+}
+
+func TestFindProjectFile(t *testing.T) {
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "a", "b")
+	if !assert.Nil(t, os.MkdirAll(sub, 0755)) {
+		return
+	}
+	_, ok := linep.FindProjectFile(sub)
+	assert.False(t, ok)
+
+	name := filepath.Join(dir, "a", linep.ProjectFileName)
+	if !assert.Nil(t, os.WriteFile(name, nil, 0644)) {
+		return
+	}
+	got, ok := linep.FindProjectFile(sub)
+	assert.True(t, ok)
+	assert.Equal(t, name, got)
+}
+
+func TestReadConfigFile(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Run("not exist", func(t *testing.T) {
+		got, err := linep.ReadConfigFile(filepath.Join(dir, "none.yaml"), false)
+		assert.Nil(t, err)
+		assert.Equal(t, &linep.ConfigFile{}, got)
+	})
+
+	t.Run("required", func(t *testing.T) {
+		_, err := linep.ReadConfigFile(filepath.Join(dir, "none.yaml"), true)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("profiles", func(t *testing.T) {
+		name := filepath.Join(dir, "config.yaml")
+		if !assert.Nil(t, os.WriteFile(name, []byte(`profile: ci
+quiet: true
+env:
+  - A=1
+profiles:
+  ci:
+    clean-env: true
+`), 0644)) {
+			return
+		}
+		got, err := linep.ReadConfigFile(name, true)
+		if !assert.Nil(t, err) {
+			return
+		}
+		assert.Equal(t, "ci", got.Profile)
+		assert.Equal(t, map[string]map[string]any{
+			"ci": {"clean-env": true},
+		}, got.Profiles)
+		assert.Equal(t, map[string]any{
+			"quiet": true,
+			"env":   []any{"A=1"},
+		}, got.Values)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		name := filepath.Join(dir, "invalid.yaml")
+		if !assert.Nil(t, os.WriteFile(name, []byte(`profiles: 1`), 0644)) {
+			return
+		}
+		_, err := linep.ReadConfigFile(name, true)
+		assert.ErrorIs(t, err, linep.ErrInvalidConfigFile)
+	})
+}
@@ -0,0 +1,151 @@
+package linep
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidDep  = errors.New("InvalidDep")
+	ErrUnknownLang = errors.New("UnknownLang")
+)
+
+const (
+	LangGo     = "go"
+	LangPython = "python"
+	LangRust   = "rust"
+)
+
+// Manifest declares dependencies of the generated script.
+type Manifest interface {
+	// Filename returns the name of the manifest file in the source directory.
+	Filename() string
+	// Write writes a manifest of the module named name, with the main file main, that requires deps.
+	Write(w io.Writer, name, main string, deps []string) error
+}
+
+func NewManifest(lang string) (Manifest, error) {
+	switch lang {
+	case LangGo:
+		return goManifest{}, nil
+	case LangPython:
+		return pythonManifest{}, nil
+	case LangRust:
+		return rustManifest{}, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownLang, lang)
+	}
+}
+
+// WriteManifest writes a manifest of deps and main into dir.
+// The module name is the basename of dir, see [ManifestName].
+func WriteManifest(dir, main string, m Manifest, deps []string) error {
+	f, err := os.Create(filepath.Join(dir, m.Filename()))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return m.Write(f, ManifestName(filepath.Base(dir)), main, deps)
+}
+
+// ManifestName returns a valid name of a module or a package from s like the basename of a directory.
+// Characters other than lowercase letters, digits, - and _ are replaced with -,
+// and it starts with a letter.
+func ManifestName(s string) string {
+	r := []byte(strings.ToLower(s))
+	for i, c := range r {
+		if !(c == '-' || c == '_' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9') {
+			r[i] = '-'
+		}
+	}
+	x := strings.Trim(string(r), "-_")
+	if x == "" || x[0] < 'a' || x[0] > 'z' {
+		x = "linep-" + x
+	}
+	return strings.TrimRight(x, "-")
+}
+
+// goManifest writes go.mod; dep is module@version.
+type goManifest struct{}
+
+func (goManifest) Filename() string { return "go.mod" }
+
+func (goManifest) Write(w io.Writer, name, _ string, deps []string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "module %s\n", name)
+	if len(deps) > 0 {
+		b.WriteString("\nrequire (\n")
+		for _, d := range deps {
+			path, version, ok := strings.Cut(d, "@")
+			if !ok || path == "" || version == "" {
+				return fmt.Errorf("%w: %s: go dependency should be module@version", ErrInvalidDep, d)
+			}
+			fmt.Fprintf(&b, "\t%s %s\n", path, version)
+		}
+		b.WriteString(")\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// pythonManifest writes requirements.txt; dep is a pip requirement specifier.
+type pythonManifest struct{}
+
+func (pythonManifest) Filename() string { return "requirements.txt" }
+
+func (pythonManifest) Write(w io.Writer, _, _ string, deps []string) error {
+	var b strings.Builder
+	for _, d := range deps {
+		d = strings.TrimSpace(d)
+		if d == "" || strings.Contains(d, "\n") {
+			return fmt.Errorf("%w: %q: python dependency should be a pip requirement specifier", ErrInvalidDep, d)
+		}
+		fmt.Fprintln(&b, d)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// rustManifest writes Cargo.toml; dep is crate=version or crate.
+// version can be an inline table like {version="1",features=["derive"]}.
+type rustManifest struct{}
+
+func (rustManifest) Filename() string { return "Cargo.toml" }
+
+func (rustManifest) Write(w io.Writer, name, main string, deps []string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, `[package]
+name = %[1]q
+version = "0.1.0"
+edition = "2021"
+
+[[bin]]
+name = %[1]q
+path = %[2]q
+
+[dependencies]
+`, name, filepath.ToSlash(main))
+	for _, d := range deps {
+		crate, version, ok := strings.Cut(d, "=")
+		crate = strings.TrimSpace(crate)
+		version = strings.TrimSpace(version)
+		if crate == "" || (ok && version == "") {
+			return fmt.Errorf("%w: %s: rust dependency should be crate=version", ErrInvalidDep, d)
+		}
+		switch {
+		case !ok:
+			version = `"*"`
+		case strings.HasPrefix(version, "{"):
+		default:
+			version = strconv.Quote(version)
+		}
+		fmt.Fprintf(&b, "%s = %s\n", crate, version)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,43 @@
+package linep_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/berquerant/linep"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManifestName(t *testing.T) {
+	for _, tc := range []struct {
+		input string
+		want  string
+	}{
+		{input: "linep0123", want: "linep0123"},
+		{input: "my_tool", want: "my_tool"},
+		{input: "my tool", want: "my-tool"},
+		{input: "My.Tool", want: "my-tool"},
+		{input: "2024-tool", want: "linep-2024-tool"},
+		{input: "_tool-", want: "tool"},
+		{input: "...", want: "linep"},
+		{input: "", want: "linep"},
+	} {
+		t.Run(tc.input, func(t *testing.T) {
+			assert.Equal(t, tc.want, linep.ManifestName(tc.input))
+		})
+	}
+}
+
+func TestRustManifest(t *testing.T) {
+	m, err := linep.NewManifest(linep.LangRust)
+	if !assert.Nil(t, err) {
+		return
+	}
+	var b bytes.Buffer
+	if !assert.Nil(t, m.Write(&b, "tool", "src/main.rs", []string{"itoa=1"})) {
+		return
+	}
+	assert.True(t, strings.Contains(b.String(), `path = "src/main.rs"`))
+	assert.True(t, strings.Contains(b.String(), `itoa = "1"`))
+}
@@ -0,0 +1,158 @@
+package linep
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+type diffLine struct {
+	// kind is ' ' (equal), '-' (only in x) or '+' (only in y).
+	kind byte
+	text string
+}
+
+// diffContext is the number of equal lines around changes.
+const diffContext = 3
+
+// WriteDiff writes the difference of the lines of x and y in the unified format.
+func WriteDiff(w io.Writer, xName, yName string, x, y []byte) error {
+	lines := diffLines(splitLines(x), splitLines(y))
+	if _, err := fmt.Fprintf(w, "--- %s\n+++ %s\n", xName, yName); err != nil {
+		return err
+	}
+	for i := 0; i < len(lines); {
+		if lines[i].kind == ' ' {
+			i++
+			continue
+		}
+		start, end := max(i-diffContext, 0), i
+		for end < len(lines) {
+			if lines[end].kind != ' ' {
+				end++
+				continue
+			}
+			k := end
+			for k < len(lines) && lines[k].kind == ' ' {
+				k++
+			}
+			if k == len(lines) || k-end > 2*diffContext {
+				end = min(end+diffContext, len(lines))
+				break
+			}
+			end = k
+		}
+
+		xLine, yLine := diffCount(lines[:start])
+		xn, yn := diffCount(lines[start:end])
+		if _, err := fmt.Fprintf(w, "@@ -%d,%d +%d,%d @@\n", xLine+1, xn, yLine+1, yn); err != nil {
+			return err
+		}
+		for _, x := range lines[start:end] {
+			if _, err := fmt.Fprintf(w, "%c%s\n", x.kind, x.text); err != nil {
+				return err
+			}
+		}
+		i = end
+	}
+	return nil
+}
+
+// diffCount returns the number of lines of x and y.
+func diffCount(lines []diffLine) (int, int) {
+	var x, y int
+	for _, d := range lines {
+		if d.kind != '+' {
+			x++
+		}
+		if d.kind != '-' {
+			y++
+		}
+	}
+	return x, y
+}
+
+func splitLines(b []byte) []string {
+	if len(b) == 0 {
+		return nil
+	}
+	s := string(b)
+	if x, ok := strings.CutSuffix(s, "\n"); ok {
+		return strings.Split(x, "\n")
+	}
+	return append(strings.Split(s, "\n"), `\ No newline at end of file`)
+}
+
+// diffLines returns the lines of x and y with the longest common subsequence as equal lines.
+func diffLines(x, y []string) []diffLine {
+	var pre, suf int
+	for pre < len(x) && pre < len(y) && x[pre] == y[pre] {
+		pre++
+	}
+	for suf < len(x)-pre && suf < len(y)-pre && x[len(x)-1-suf] == y[len(y)-1-suf] {
+		suf++
+	}
+	var r []diffLine
+	for _, s := range x[:pre] {
+		r = append(r, diffLine{kind: ' ', text: s})
+	}
+	r = append(r, diffMiddle(x[pre:len(x)-suf], y[pre:len(y)-suf])...)
+	for _, s := range x[len(x)-suf:] {
+		r = append(r, diffLine{kind: ' ', text: s})
+	}
+	return r
+}
+
+// diffMaxCells limits the table of the longest common subsequence.
+const diffMaxCells = 1 << 22
+
+func diffMiddle(x, y []string) []diffLine {
+	var r []diffLine
+	if (len(x)+1)*(len(y)+1) > diffMaxCells {
+		// too large, replace all
+		for _, s := range x {
+			r = append(r, diffLine{kind: '-', text: s})
+		}
+		for _, s := range y {
+			r = append(r, diffLine{kind: '+', text: s})
+		}
+		return r
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of x[i:] and y[j:]
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	var i, j int
+	for i < len(x) && j < len(y) {
+		switch {
+		case x[i] == y[j]:
+			r = append(r, diffLine{kind: ' ', text: x[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			r = append(r, diffLine{kind: '-', text: x[i]})
+			i++
+		default:
+			r = append(r, diffLine{kind: '+', text: y[j]})
+			j++
+		}
+	}
+	for ; i < len(x); i++ {
+		r = append(r, diffLine{kind: '-', text: x[i]})
+	}
+	for ; j < len(y); j++ {
+		r = append(r, diffLine{kind: '+', text: y[j]})
+	}
+	return r
+}
@@ -0,0 +1,81 @@
+package linep_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/berquerant/linep"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteDiff(t *testing.T) {
+	for _, tc := range []struct {
+		title string
+		x     string
+		y     string
+		want  string
+	}{
+		{
+			title: "equal",
+			x:     "a\nb\n",
+			y:     "a\nb\n",
+			want:  "",
+		},
+		{
+			title: "change",
+			x:     "1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			y:     "1\n2\n3\n4\nx\n6\n7\n8\n9\n",
+			want: `@@ -2,7 +2,7 @@
+ 2
+ 3
+ 4
+-5
++x
+ 6
+ 7
+ 8
+`,
+		},
+		{
+			title: "hunks",
+			x:     "a\n1\n2\n3\n4\n5\n6\n7\nb\n",
+			y:     "1\n2\n3\n4\n5\n6\n7\n",
+			want: `@@ -1,4 +1,3 @@
+-a
+ 1
+ 2
+ 3
+@@ -6,4 +5,3 @@
+ 5
+ 6
+ 7
+-b
+`,
+		},
+		{
+			title: "insert into empty",
+			x:     "",
+			y:     "a\n",
+			want: `@@ -1,0 +1,1 @@
++a
+`,
+		},
+		{
+			title: "no newline",
+			x:     "a\n",
+			y:     "a",
+			want: `@@ -1,1 +1,2 @@
+ a
++\ No newline at end of file
+`,
+		},
+	} {
+		t.Run(tc.title, func(t *testing.T) {
+			var b bytes.Buffer
+			if !assert.Nil(t, linep.WriteDiff(&b, "x", "y", []byte(tc.x), []byte(tc.y))) {
+				return
+			}
+			assert.Equal(t, "--- x\n+++ y\n"+tc.want, b.String())
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package linep
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+var (
+	ErrInvalidEnv = errors.New("InvalidEnv")
+)
+
+// CleanEnvAllowlist is patterns of the environment variables passed to steps with --clean-env.
+var CleanEnvAllowlist = []string{
+	"PATH",
+	"HOME",
+	"USER",
+	"LOGNAME",
+	"SHELL",
+	"TERM",
+	"TMPDIR",
+	"TZ",
+	"LANG",
+	"LC_*",
+	// go
+	"GOPATH",
+	"GOROOT",
+	"GOBIN",
+	"GOCACHE",
+	"GOMODCACHE",
+	"GOENV",
+	"GOFLAGS",
+	"GOPROXY",
+	"GOPRIVATE",
+	"GONOPROXY",
+	"GONOSUMDB",
+	"GOSUMDB",
+	"GOINSECURE",
+	"GOTOOLCHAIN",
+	"GOOS",
+	"GOARCH",
+	"GOAMD64",
+	"GOARM",
+	"GOARM64",
+	"GOEXPERIMENT",
+	"GODEBUG",
+	"GOWORK",
+	"CGO_*",
+	// rust
+	"CARGO_*",
+	"RUSTUP_*",
+	"RUSTC_*",
+	// python
+	"PYENV_*",
+	"PIPENV_*",
+	"VIRTUAL_ENV",
+}
+
+func isAllowedEnv(key string) bool {
+	for _, p := range CleanEnvAllowlist {
+		if ok, _ := path.Match(p, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// CleanEnviron returns KEY=VALUE of the environment variables in [CleanEnvAllowlist].
+func CleanEnviron() []string {
+	var r []string
+	for _, x := range os.Environ() {
+		k, _, _ := strings.Cut(x, "=")
+		if isAllowedEnv(k) {
+			r = append(r, x)
+		}
+	}
+	return r
+}
+
+// lookupEnv returns the key and the value of KEY=VALUE, or KEY from the environment.
+func lookupEnv(s string) (string, string, bool) {
+	if k, v, ok := strings.Cut(s, "="); ok {
+		return k, v, true
+	}
+	v, ok := os.LookupEnv(s)
+	return s, v, ok
+}
+
+// ValidateEnv validates KEY=VALUE or KEY.
+func ValidateEnv(s string) error {
+	k, _, _ := strings.Cut(s, "=")
+	if k == "" || strings.ContainsAny(k, " \t\x00") {
+		return fmt.Errorf("%w: %q", ErrInvalidEnv, s)
+	}
+	return nil
+}
+
+// RedactEnv returns the keys of KEY=VALUE not to save the values like secrets.
+func RedactEnv(env []string) []string {
+	r := make([]string, len(env))
+	for i, x := range env {
+		r[i], _, _ = strings.Cut(x, "=")
+	}
+	return r
+}
+
+// RedactEnvArgs returns the command-line arguments with --env KEY=VALUE replaced with --env KEY.
+func RedactEnvArgs(args []string) []string {
+	r := make([]string, len(args))
+	for i, x := range args {
+		switch {
+		case x == "--":
+			copy(r[i:], args[i:])
+			return r
+		case i > 0 && args[i-1] == "--env":
+			x, _, _ = strings.Cut(x, "=")
+		case strings.HasPrefix(x, "--env="):
+			x, _, _ = strings.Cut(strings.TrimPrefix(x, "--env="), "=")
+			x = "--env=" + x
+		}
+		r[i] = x
+	}
+	return r
+}
+
+// ParseEnvFile parses lines of KEY=VALUE.
+// Empty lines and lines starting with # are ignored, 'export' prefix and quotes of the values are removed.
+func ParseEnvFile(r io.Reader) ([]string, error) {
+	var (
+		result  []string
+		scanner = bufio.NewScanner(r)
+		lineNum int
+	)
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		k, v, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%w: line %d: should be KEY=VALUE", ErrInvalidEnv, lineNum)
+		}
+		k = strings.TrimSpace(k)
+		v = strings.TrimSpace(v)
+		if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+			v = v[1 : len(v)-1]
+		}
+		x := k + "=" + v
+		if err := ValidateEnv(x); err != nil {
+			return nil, fmt.Errorf("%w: line %d", err, lineNum)
+		}
+		result = append(result, x)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func ReadEnvFile(name string) ([]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseEnvFile(f)
+}
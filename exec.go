@@ -6,9 +6,12 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/berquerant/execx"
 	"gopkg.in/yaml.v3"
@@ -18,17 +21,37 @@ type Executor struct {
 	Shell           []string
 	Template        *Template
 	Args            *ScriptArgs
+	Macros          map[string]string
+	Env             []string
+	CleanEnv        bool
+	Cwd             string
+	Check           bool
 	ExecPWD         string
 	WorkDir         string
 	KeepScript      bool
 	Dry             bool
+	Fmt             bool
 	DisplayTemplate bool
+	Plan            bool
+	JSON            bool
+	// Record is the bundle file to record the run into.
+	Record string
+	// Export is the directory to export the project into.
+	Export string
+	// Binary is the executable to build with Export.
+	Binary string
+	// CommandLine is the command-line arguments without the command name.
+	CommandLine []string
 
 	Stdin  io.Reader
 	Stdout io.Writer
 	Stderr io.Writer
 
-	tmpDir string
+	tmpDir    string
+	cacheDir  string
+	sourceMap *SourceMap
+	// bundle is the base of the bundle of Record.
+	bundle Bundle
 }
 
 func (e *Executor) init() error {
@@ -37,6 +60,10 @@ func (e *Executor) init() error {
 			return err
 		}
 	}
+	if e.tmpDir != "" {
+		// export sets the source directory
+		return nil
+	}
 	dir, err := MkdirTemp(e.WorkDir, "linep")
 	if err != nil {
 		return err
@@ -54,42 +81,303 @@ func (e *Executor) Execute(ctx context.Context) error {
 		return nil
 	}
 
+	if e.Plan {
+		if err := e.displayPlan(e.Stdout); err != nil {
+			return fmt.Errorf("%w: plan", err)
+		}
+		return nil
+	}
+
 	if e.Dry {
-		if err := e.dump(os.Stdout); err != nil {
+		if err := e.dry(ctx, os.Stdout); err != nil {
 			return fmt.Errorf("%w: dry run", err)
 		}
 		return nil
 	}
 
+	if e.Export != "" {
+		if e.Record != "" {
+			return fmt.Errorf("%w: --record is not available", ErrExport)
+		}
+		return e.export(ctx)
+	}
+	if e.Record != "" {
+		return e.record(ctx)
+	}
+	return e.execute(ctx)
+}
+
+func (e *Executor) execute(ctx context.Context) error {
+	steps, scripts, err := e.prepare()
+	if err != nil {
+		return err
+	}
+	if e.Record != "" {
+		if err := e.recordFiles(&e.bundle); err != nil {
+			return fmt.Errorf("%w: record", err)
+		}
+	}
+	if e.Check {
+		return e.check(ctx, steps, scripts)
+	}
+	return e.runSteps(ctx, steps, scripts)
+}
+
+// prepare renders the script and the steps into a new source directory.
+func (e *Executor) prepare() ([]Step, []string, error) {
 	slog.Debug("init")
 	if err := e.init(); err != nil {
-		return fmt.Errorf("%w: exec init", err)
+		return nil, nil, fmt.Errorf("%w: exec init", err)
 	}
 	slog.Debug("render")
-	if err := e.renderTemplate(); err != nil {
-		return fmt.Errorf("%w: render template", err)
+	files, err := e.renderSources()
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: render template", err)
+	}
+	if err := e.writeSources(files); err != nil {
+		return nil, nil, fmt.Errorf("%w: write sources", err)
+	}
+	if err := e.initSourceMap(); err != nil {
+		return nil, nil, fmt.Errorf("%w: source map", err)
+	}
+	steps, scripts, err := e.renderSteps()
+	if err != nil {
+		return nil, nil, err
 	}
-	slog.Debug("run:init")
-	// redirect init output to stderr
-	if err := e.runScript(ctx, nil, e.Stderr, e.Stderr, e.Template.Init); err != nil {
-		return fmt.Errorf("%w: run init", err)
+	slog.Debug("cache")
+	e.cacheDir = e.cacheDirOf(files)
+	if err := e.initCache(); err != nil {
+		return nil, nil, fmt.Errorf("%w: init cache", err)
 	}
-	slog.Debug("run:exec")
-	if err := e.runScript(ctx, e.Stdin, e.Stdout, e.Stderr, e.Template.Exec); err != nil {
-		return fmt.Errorf("%w: run exec", err)
+	slog.Debug("manifest")
+	if err := e.writeManifest(); err != nil {
+		return nil, nil, fmt.Errorf("%w: write manifest", err)
+	}
+	return steps, scripts, nil
+}
+
+// renderSteps returns the steps of the template and their rendered script commands.
+func (e Executor) renderSteps() ([]Step, []string, error) {
+	steps := e.Template.StepList()
+	scripts := make([]string, len(steps))
+	for i, s := range steps {
+		x, err := e.renderStep(s)
+		if err != nil {
+			return nil, nil, err
+		}
+		scripts[i] = x
 	}
+	return steps, scripts, nil
+}
 
+func (e *Executor) initSourceMap() error {
+	m, err := e.Template.SourceMap(e.Args)
+	if err != nil {
+		return err
+	}
+	if m != nil {
+		m.Filename = e.scriptFilename()
+	}
+	e.sourceMap = m
 	return nil
 }
 
-func (e Executor) renderTemplate() error {
-	f, err := os.Create(e.scriptFilename())
+// renderStep renders the script command of the step, macros are replaced with references of environment variables.
+func (e Executor) renderStep(step Step) (string, error) {
+	return e.renderStepWith(step, e.replaceMacros)
+}
+
+// renderStepWith renders the script command of the step and then replaces macros by replace.
+// @ of the values of the fields like ARGS are escaped not to be replaced.
+func (e Executor) renderStepWith(step Step, replace func(string) string) (string, error) {
+	var b bytes.Buffer
+	if err := e.Template.ExecuteStep(&b, step, e.Args.escapeMacros()); err != nil {
+		return "", fmt.Errorf("%w: render %s", err, step.Name)
+	}
+	return replace(b.String()), nil
+}
+
+// check runs the steps before the exec step and the check of the template without stdin.
+func (e Executor) check(ctx context.Context, steps []Step, scripts []string) error {
+	if e.Template.Check == "" {
+		return fmt.Errorf("%w: no check", ErrInvalidTemplate)
+	}
+	i := slices.IndexFunc(steps, func(s Step) bool { return s.Name == StepExec })
+	if i < 0 {
+		i = len(steps)
+	}
+	if err := e.runSteps(ctx, steps[:i], scripts[:i]); err != nil {
+		return err
+	}
+
+	step := Step{
+		Name: StepCheck,
+		Run:  e.Template.Check,
+	}
+	script, err := e.renderStep(step)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
+	slog.Debug("run:" + step.Name)
+	if err := e.runScript(ctx, e.tmpDir, nil, e.Stdout, e.Stderr, script); err != nil {
+		return fmt.Errorf("%w: run %s", err, step.Name)
+	}
+	return nil
+}
+
+func (e Executor) runSteps(ctx context.Context, steps []Step, scripts []string) error {
+	var err error
+	for i, s := range steps {
+		if !s.ShouldRun(err != nil) {
+			slog.Debug("skip:"+s.Name, slog.String("when", s.When))
+			continue
+		}
+		if s.Cache && e.isCached(s, scripts[i]) {
+			slog.Debug("skip:"+s.Name, slog.String("cache", e.cacheDir))
+			continue
+		}
+		slog.Debug("run:" + s.Name)
+		runCtx := ctx
+		if s.When != WhenSuccess {
+			// run even if interrupted
+			runCtx = context.WithoutCancel(ctx)
+		}
+		if x := e.runStep(runCtx, s, scripts[i]); x != nil {
+			if err == nil {
+				err = fmt.Errorf("%w: run %s", x, s.Name)
+			}
+			continue
+		}
+		if s.Cache {
+			if x := e.markCached(s, scripts[i]); x != nil {
+				slog.Warn("mark cache", slog.String("step", s.Name), WithErr(x))
+			}
+		}
+	}
+
+	return err
+}
+
+// cacheDirOf returns the cache directory determined by the sources without the manifest
+// because it depends on the random name of the source directory.
+func (e Executor) cacheDirOf(files map[string][]byte) string {
+	h := HashString(strings.Join(append([]string{HashFiles(files), e.Template.Lang}, e.deps()...), "\x00"))
+	return filepath.Join(cacheRoot(e.WorkDir), h)
+}
+
+// initCache creates the cache directory if the template has cached steps,
+// and updates its modification time as the last use for [RemoveCache].
+func (e Executor) initCache() error {
+	if !slices.ContainsFunc(e.Template.StepList(), func(s Step) bool { return s.Cache }) {
+		return nil
+	}
+	if err := os.MkdirAll(e.cacheDir, 0755); err != nil {
+		return err
+	}
+	now := time.Now()
+	return os.Chtimes(e.cacheDir, now, now)
+}
 
-	return e.dump(f)
+func (e Executor) cacheMarker(step Step, script string) string {
+	return filepath.Join(e.cacheDir, fmt.Sprintf(".%s-%s", step.Name, HashString(script)))
+}
+
+func (e Executor) isCached(step Step, script string) bool {
+	_, err := os.Stat(e.cacheMarker(step, script))
+	return err == nil
+}
+
+func (e Executor) markCached(step Step, script string) error {
+	f, err := os.Create(e.cacheMarker(step, script))
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// stepDir returns the working directory of the step.
+func (e Executor) stepDir(step Step) string {
+	if step.Name == StepExec && e.cwd() == CwdExec {
+		return e.ExecPWD
+	}
+	return e.tmpDir
+}
+
+func (e Executor) cwd() string {
+	if e.Cwd != "" {
+		return e.Cwd
+	}
+	return e.Template.Cwd
+}
+
+func (e Executor) runStep(ctx context.Context, step Step, script string) error {
+	if script == "" {
+		return nil
+	}
+	dir := e.stepDir(step)
+	switch step.Stdio {
+	case StdioAttach:
+		return e.runScript(ctx, dir, e.Stdin, e.Stdout, e.Stderr, script)
+	case StdioQuiet:
+		var b bytes.Buffer
+		err := e.runScript(ctx, dir, nil, &b, &b, script)
+		if err != nil {
+			// show hidden outputs to know why it failed
+			_, _ = io.Copy(e.Stderr, &b)
+		}
+		return err
+	default:
+		return e.runScript(ctx, dir, nil, e.Stderr, e.Stderr, script)
+	}
+}
+
+// renderSources returns the generated script and the files of the template, relative path to content.
+func (e Executor) renderSources() (map[string][]byte, error) {
+	var b bytes.Buffer
+	if err := e.dump(&b); err != nil {
+		return nil, err
+	}
+	r := map[string][]byte{
+		filepath.Clean(e.Template.Main): b.Bytes(),
+	}
+	for name := range e.Template.Files {
+		var b bytes.Buffer
+		if err := e.Template.ExecuteFile(&b, name, e.Args); err != nil {
+			return nil, fmt.Errorf("%w: file %s", err, name)
+		}
+		r[filepath.Clean(name)] = b.Bytes()
+	}
+	return r, nil
+}
+
+// writeSources writes the files of renderSources into the source directory.
+func (e Executor) writeSources(files map[string][]byte) error {
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		x := filepath.Join(e.tmpDir, name)
+		if err := os.MkdirAll(filepath.Dir(x), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(x, files[name], 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e Executor) deps() []string {
+	return append(slices.Clone(e.Template.Deps), e.Args.Dep...)
+}
+
+func (e Executor) writeManifest() error {
+	deps := e.deps()
+	if len(deps) == 0 {
+		return nil
+	}
+	m, err := NewManifest(e.Template.Lang)
+	if err != nil {
+		return err
+	}
+	return WriteManifest(e.tmpDir, e.Template.Main, m, deps)
 }
 
 func (e Executor) displayTemplate(w io.Writer) error {
@@ -106,71 +394,148 @@ func (e Executor) dump(w io.Writer) error {
 	if err := e.Template.Execute(&b, e.Args); err != nil {
 		return err
 	}
-	_, err := fmt.Fprintf(w, "%s", e.replaceMacros(b.String()))
+	script := b.String()
+	if e.Template.ExpandScript {
+		script = e.replaceMacros(script)
+	}
+	_, err := fmt.Fprintf(w, "%s", script)
+	return err
+}
+
+// dry writes the generated script, formatted if Fmt and highlighted if w is a terminal.
+func (e Executor) dry(ctx context.Context, w *os.File) error {
+	var b bytes.Buffer
+	if err := e.dump(&b); err != nil {
+		return err
+	}
+	script := b.String()
+	if e.Fmt {
+		x, err := e.format(ctx, script)
+		if err != nil {
+			return fmt.Errorf("%w: fmt", err)
+		}
+		script = x
+	}
+	if IsColorEnabled(w) {
+		return Highlight(w, e.Template.Lang, script)
+	}
+	_, err := fmt.Fprint(w, script)
 	return err
 }
 
+// format formats the script by the fmt of the template in the current directory.
+func (e Executor) format(ctx context.Context, script string) (string, error) {
+	if e.Template.Fmt == "" {
+		return "", fmt.Errorf("%w: no fmt", ErrInvalidTemplate)
+	}
+	x, err := e.renderStep(Step{
+		Name: StepFmt,
+		Run:  e.Template.Fmt,
+	})
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	if err := e.runScript(ctx, e.ExecPWD, bytes.NewBufferString(script), &b, e.Stderr, x); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
 func (e Executor) scriptFilename() string {
 	return filepath.Join(e.tmpDir, e.Template.Main)
 }
 
-func (Executor) replaceMacros(s string) string {
-	seed := []string{
-		"EXEC_PWD",
-		"MAIN",
-		"SRC_DIR",
-		"WORK_DIR",
+// macros returns macro names and values.
+// Macros of the template are overridden by e.Macros.
+func (e Executor) macros() map[string]string {
+	m := maps.Clone(e.Template.Macros)
+	if m == nil {
+		m = map[string]string{}
+	}
+	maps.Copy(m, e.Macros)
+	// --env overrides macros except builtin ones
+	for _, x := range e.Env {
+		k, v, ok := lookupEnv(x)
+		if _, found := m[k]; found && ok {
+			m[k] = v
+		}
 	}
-	var (
-		v = make([]string, len(seed)*2)
-		i int
-	)
-	for _, x := range seed {
-		v[i] = "@" + x
-		i++
-		v[i] = fmt.Sprintf(`"${%s}"`, x)
-		i++
+	m[MacroExecPWD] = e.ExecPWD
+	m[MacroMain] = e.Template.Main
+	m[MacroSrcDir] = filepath.Dir(e.scriptFilename())
+	m[MacroWorkDir] = e.WorkDir
+	m[MacroCacheDir] = e.cacheDir
+	if e.Binary != "" {
+		m[MacroBinary] = e.Binary
 	}
-	return strings.NewReplacer(v...).Replace(s)
+	return m
 }
 
+func (e Executor) replaceMacros(s string) string {
+	m := e.macros()
+	return ExpandMacros(s, func(name string) bool {
+		_, ok := m[name]
+		return ok
+	})
+}
+
+// newEnv returns the environment of steps.
+// The environment of linep, or allowlisted ones if CleanEnv, is overridden by
+// the env of the template, Env and macros in order.
 func (e Executor) newEnv() execx.Env {
+	base := execx.EnvFromEnviron()
 	env := execx.EnvFromEnviron()
-	env.Set("EXEC_PWD", e.ExecPWD)
-	env.Set("MAIN", e.Template.Main)
-	env.Set("SRC_DIR", filepath.Dir(e.scriptFilename()))
-	env.Set("WORK_DIR", e.WorkDir)
+	if e.CleanEnv {
+		env = execx.NewEnv()
+		for _, x := range CleanEnviron() {
+			k, v, _ := strings.Cut(x, "=")
+			env.Set(k, v)
+		}
+	}
+	for _, k := range slices.Sorted(maps.Keys(e.Template.Env)) {
+		env.Set(k, base.Expand(e.Template.Env[k]))
+	}
+	for _, x := range e.Env {
+		if k, v, ok := lookupEnv(x); ok {
+			env.Set(k, v)
+		}
+	}
+	for k, v := range e.macros() {
+		env.Set(k, v)
+	}
 	return env
 }
 
 func (e Executor) runScript(
 	ctx context.Context,
+	dir string,
 	stdin io.Reader,
 	stdout io.Writer,
 	stderr io.Writer,
 	script string,
 ) error {
-	script = e.replaceMacros(script)
 	s := execx.NewScript(script, e.Shell[0], e.Shell[1:]...)
 	s.Env = e.newEnv()
 	// s.KeepScriptFile = e.KeepScript
 
 	logAttr := []any{
-		slog.String("dir", e.tmpDir),
+		slog.String("dir", dir),
 		slog.String("script", script),
 		slog.String("expaned_script", s.Env.Expand(script)),
+		slog.Any("env", slices.Sorted(slices.Values(s.Env.IntoSlice()))),
 	}
 	slog.Debug("executor:run", logAttr...)
 
 	err := s.Runner(func(cmd *execx.Cmd) error {
-		cmd.Dir = e.tmpDir
+		cmd.Dir = dir
 		cmd.Stdin = stdin
 		_, err := cmd.Run(
 			ctx,
 			execx.WithStdoutWriter(new(execx.NullBuffer)),
 			execx.WithStderrWriter(new(execx.NullBuffer)),
 			execx.WithStdoutConsumer(e.logConsumer(stdout)),
-			execx.WithStderrConsumer(e.logConsumer(stderr)),
+			execx.WithStderrConsumer(e.errConsumer(stderr)),
 		)
 		return err
 	})
@@ -184,10 +549,23 @@ func (Executor) logConsumer(w io.Writer) func(execx.Token) {
 	}
 }
 
-func (e Executor) Close() error {
-	if e.KeepScript {
+// errConsumer writes lines of stderr, locations of the script in them are rewritten
+// into the locations of INIT, MAP and REDUCE.
+func (e Executor) errConsumer(w io.Writer) func(execx.Token) {
+	if e.sourceMap == nil {
+		return e.logConsumer(w)
+	}
+	return func(t execx.Token) {
+		for _, x := range e.sourceMap.Rewrite(t.String()) {
+			fmt.Fprintln(w, x)
+		}
+	}
+}
+
+func (e *Executor) Close() error {
+	if e.KeepScript || e.tmpDir == "" {
 		return nil
 	}
-	slog.Debug("executor:close", slog.String("work_dir", e.WorkDir))
-	return os.RemoveAll(e.WorkDir)
+	slog.Debug("executor:close", slog.String("src_dir", e.tmpDir))
+	return os.RemoveAll(e.tmpDir)
 }
@@ -0,0 +1,268 @@
+package linep
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var (
+	ErrExport = errors.New("Export")
+)
+
+// export writes the generated script and the results of the steps before the exec step into Export
+// with README.md and Makefile, and builds Binary.
+func (e *Executor) export(ctx context.Context) error {
+	if e.Binary != "" && e.Template.Binary == "" {
+		return fmt.Errorf("%w: no binary", ErrInvalidTemplate)
+	}
+	dir, err := filepath.Abs(e.Export)
+	if err != nil {
+		return err
+	}
+	if xs, err := os.ReadDir(dir); err == nil && len(xs) > 0 {
+		return fmt.Errorf("%w: %s is not empty", ErrExport, dir)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	// the project is the source directory
+	e.tmpDir = dir
+	e.KeepScript = true
+
+	steps, scripts, err := e.prepare()
+	if err != nil {
+		return err
+	}
+	e.cacheDir = filepath.Join(dir, ".cache")
+	if err := os.MkdirAll(e.cacheDir, 0755); err != nil {
+		return err
+	}
+	i := slices.IndexFunc(steps, func(s Step) bool { return s.Name == StepExec })
+	if i < 0 {
+		i = len(steps)
+	}
+	if err := e.runSteps(ctx, steps[:i], scripts[:i]); err != nil {
+		return err
+	}
+
+	makefile, err := e.makefile(steps)
+	if err != nil {
+		return fmt.Errorf("%w: Makefile", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "Makefile"), []byte(makefile), 0644); err != nil {
+		return err
+	}
+	readme, err := e.readme(steps)
+	if err != nil {
+		return fmt.Errorf("%w: README.md", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "README.md"), []byte(readme), 0644); err != nil {
+		return err
+	}
+	slog.Info("exported", slog.String("dir", dir))
+
+	if e.Binary == "" {
+		return nil
+	}
+	if err := e.buildBinary(ctx); err != nil {
+		return fmt.Errorf("%w: binary", err)
+	}
+	slog.Info("built", slog.String("binary", e.Binary))
+	return nil
+}
+
+// buildBinary builds Binary by the binary of the template.
+func (e *Executor) buildBinary(ctx context.Context) error {
+	out, err := filepath.Abs(e.Binary)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(out), 0755); err != nil {
+		return err
+	}
+	e.Binary = out
+	x, err := e.renderStep(Step{
+		Name: StepBinary,
+		Run:  e.Template.Binary,
+	})
+	if err != nil {
+		return err
+	}
+	return e.runScript(ctx, e.tmpDir, nil, e.Stderr, e.Stderr, x)
+}
+
+var makeVariablePattern = regexp.MustCompile(`\$(\{[A-Za-z_][A-Za-z0-9_]*\}|[A-Za-z_][A-Za-z0-9_]*)?`)
+
+// makeValue escapes s as a value of a make variable.
+// References of environment variables like $HOME are converted into make variables if expand.
+func makeValue(s string, expand bool) (string, error) {
+	if strings.ContainsAny(s, "\n\r") {
+		return "", fmt.Errorf("%w: multiline value: %q", ErrExport, s)
+	}
+	s = makeVariablePattern.ReplaceAllStringFunc(s, func(x string) string {
+		name := strings.Trim(strings.TrimPrefix(x, "$"), "{}")
+		if !expand || name == "" {
+			return "$" + x
+		}
+		return "$(" + name + ")"
+	})
+	return strings.ReplaceAll(s, "#", `\#`), nil
+}
+
+// makeArgs is ARGS of the steps rendered for the Makefile, replaced with the variable ARGS.
+const makeArgs = "LINEP_MAKE_ARGS"
+
+// makefile returns the Makefile with a target for each step, running in the directory of it.
+// Macros and environment variables of steps are exported variables, ARGS is the variable ARGS.
+// Values of --env-file and --env are passed from the environment of make.
+func (e Executor) makefile(steps []Step) (string, error) {
+	if e.Template.Binary != "" {
+		// make @BINARY known, the value is the variable of the Makefile
+		e.Binary = MacroBinary
+	}
+	args := ShJoin(e.Args.Args)
+	scriptArgs := *e.Args
+	scriptArgs.Args = []string{makeArgs}
+	e.Args = &scriptArgs
+	var b strings.Builder
+	b.WriteString("# Generated by linep export.\n")
+	fmt.Fprintf(&b, "SHELL := %s\n", e.Shell[0])
+	fmt.Fprintf(&b, ".SHELLFLAGS := %s\n", strings.Join(append(slices.Clone(e.Shell[1:]), "-c"), " "))
+	b.WriteString(".ONESHELL:\n")
+	if slices.ContainsFunc(steps, func(s Step) bool { return s.Name == StepExec }) {
+		fmt.Fprintf(&b, ".DEFAULT_GOAL := %s\n", StepExec)
+	}
+	b.WriteString("\n")
+
+	export := func(op, name, value string, expand bool) error {
+		x, err := makeValue(value, expand)
+		if err != nil {
+			return fmt.Errorf("%w: %s", err, name)
+		}
+		fmt.Fprintf(&b, "export %s %s %s\n", name, op, x)
+		return nil
+	}
+	for _, k := range slices.Sorted(maps.Keys(e.Template.Env)) {
+		if err := export(":=", k, e.Template.Env[k], true); err != nil {
+			return "", err
+		}
+	}
+	envKeys := RedactEnv(e.Env)
+	for _, k := range slices.Compact(slices.Sorted(slices.Values(envKeys))) {
+		// not to write secrets
+		fmt.Fprintf(&b, "export %s\n", k)
+	}
+	macros := e.macros()
+	for _, k := range slices.Sorted(maps.Keys(macros)) {
+		if slices.Contains(envKeys, k) {
+			// overridden by --env
+			continue
+		}
+		var v string
+		switch k {
+		case MacroSrcDir, MacroWorkDir:
+			v = "$(CURDIR)"
+		case MacroCacheDir:
+			v = "$(CURDIR)/.cache"
+		case MacroExecPWD:
+			fmt.Fprintf(&b, "export %s ?= $(CURDIR)\n", k)
+			continue
+		case MacroBinary:
+			continue
+		default:
+			x, err := makeValue(macros[k], false)
+			if err != nil {
+				return "", fmt.Errorf("%w: macro %s", err, k)
+			}
+			v = x
+		}
+		fmt.Fprintf(&b, "export %s := %s\n", k, v)
+	}
+	if e.Template.Binary != "" {
+		fmt.Fprintf(&b, "export %s ?= $(CURDIR)/bin/$(notdir $(CURDIR))\n", MacroBinary)
+	}
+	x, err := makeValue(args, false)
+	if err != nil {
+		return "", fmt.Errorf("%w: ARGS", err)
+	}
+	fmt.Fprintf(&b, "ARGS ?= %s\n", x)
+
+	targets := make([]string, len(steps))
+	for i, s := range steps {
+		targets[i] = s.Name
+	}
+	if e.Template.Binary != "" {
+		targets = append(targets, StepBinary)
+	}
+	fmt.Fprintf(&b, "\n.PHONY: %s\n", strings.Join(targets, " "))
+
+	argsReplacer := strings.NewReplacer(ShQuote(makeArgs), "$(ARGS)", makeArgs, "$(ARGS)")
+	recipe := func(name, script string) {
+		fmt.Fprintf(&b, "\n%s:\n", name)
+		for _, x := range strings.Split(strings.TrimRight(script, "\n"), "\n") {
+			fmt.Fprintf(&b, "\t%s\n", argsReplacer.Replace(strings.ReplaceAll(x, "$", "$$")))
+		}
+	}
+	for _, s := range steps {
+		script, err := e.renderStep(s)
+		if err != nil {
+			return "", err
+		}
+		if s.Name == StepExec && e.cwd() == CwdExec {
+			script = fmt.Sprintf("cd %s\n%s", e.replaceMacros("@"+MacroExecPWD), script)
+		}
+		recipe(s.Name, script)
+	}
+	if e.Template.Binary != "" {
+		x, err := e.renderStep(Step{
+			Name: StepBinary,
+			Run:  e.Template.Binary,
+		})
+		if err != nil {
+			return "", err
+		}
+		recipe(StepBinary, fmt.Sprintf("mkdir -p \"$(dirname %s)\"\n%s", e.replaceMacros("@"+MacroBinary), x))
+	}
+	return b.String(), nil
+}
+
+// readme returns README.md of the exported project.
+func (e Executor) readme(steps []Step) (string, error) {
+	files, err := listFiles(e.tmpDir)
+	if err != nil {
+		return "", err
+	}
+	files = slices.DeleteFunc(files, func(x string) bool {
+		return strings.HasPrefix(x, ".cache"+string(filepath.Separator))
+	})
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", filepath.Base(e.tmpDir))
+	fmt.Fprintf(&b, "Generated by `linep export` from the %s template:\n\n", e.Template.Name)
+	fmt.Fprintf(&b, "```sh\n%s\n```\n\n", shellCommandLine(RedactEnvArgs(e.CommandLine)))
+	b.WriteString("## Usage\n\n")
+	b.WriteString("```sh\ncat input.txt | make -s\n# with arguments\ncat input.txt | make -s ARGS='a b'\n```\n\n")
+	b.WriteString("Environment variables of `--env-file` and `--env` should be set when running make.\n")
+	b.WriteString("The steps before exec have already run, run `make STEP` to run them again.\n")
+	b.WriteString("Stdio, when and cache of the steps of linep are not reproduced.\n\n")
+	b.WriteString("## Targets\n\n")
+	for _, s := range steps {
+		fmt.Fprintf(&b, "- `%s`\n", s.Name)
+	}
+	if e.Template.Binary != "" {
+		fmt.Fprintf(&b, "- `%s`: build the executable `$%s`, default is `bin/%s`\n", StepBinary, MacroBinary, filepath.Base(e.tmpDir))
+	}
+	b.WriteString("\n## Files\n\n")
+	for _, x := range files {
+		fmt.Fprintf(&b, "- `%s`\n", filepath.ToSlash(x))
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,186 @@
+package linep
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Masterminds/sprig"
+)
+
+// funcMap returns functions available in templates: sprig and linep specific ones.
+func funcMap() template.FuncMap {
+	m := sprig.TxtFuncMap()
+	m["shQuote"] = ShQuote
+	m["shJoin"] = ShJoin
+	m["reindent"] = Reindent
+	m["goQuote"] = GoQuote
+	m["pyQuote"] = PyQuote
+	m["rustQuote"] = RustQuote
+	return m
+}
+
+// Reindent indents each line of s by n spaces, with a newline at the head like sprig's nindent.
+// Empty lines are not indented.
+func Reindent(n int, s string) string {
+	var (
+		pad   = strings.Repeat(" ", n)
+		lines = strings.Split(s, "\n")
+	)
+	for i, x := range lines {
+		if strings.TrimSpace(x) != "" {
+			lines[i] = pad + x
+		}
+	}
+	return "\n" + strings.Join(lines, "\n")
+}
+
+// NormalizeCode removes leading and trailing blank lines and the common leading whitespace of lines.
+// If tabWidth is positive, tabs in the leading whitespace are converted into tabWidth spaces before that.
+func NormalizeCode(s string, tabWidth int) string {
+	lines := strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	var (
+		prefix    string
+		hasPrefix bool
+	)
+	for i, x := range lines {
+		if tabWidth > 0 {
+			body := strings.TrimLeft(x, " \t")
+			indent := x[:len(x)-len(body)]
+			x = strings.ReplaceAll(indent, "\t", strings.Repeat(" ", tabWidth)) + body
+			lines[i] = x
+		}
+		if strings.TrimSpace(x) == "" {
+			continue
+		}
+		indent := x[:len(x)-len(strings.TrimLeft(x, " \t"))]
+		if !hasPrefix {
+			prefix = indent
+			hasPrefix = true
+			continue
+		}
+		prefix = commonPrefix(prefix, indent)
+	}
+
+	for i, x := range lines {
+		if strings.TrimSpace(x) == "" {
+			lines[i] = ""
+			continue
+		}
+		lines[i] = x[len(prefix):]
+	}
+	return strings.Join(lines, "\n")
+}
+
+func commonPrefix(a, b string) string {
+	n := min(len(a), len(b))
+	for i := range n {
+		if a[i] != b[i] {
+			return a[:i]
+		}
+	}
+	return a[:n]
+}
+
+// ShQuote quotes s as a single word of POSIX shell.
+func ShQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// GoQuote returns a Go string literal of s.
+// Invalid UTF-8 bytes are kept as \x escapes.
+func GoQuote(s string) string {
+	return strconv.Quote(s)
+}
+
+// PyQuote returns a Python string literal of s.
+// Invalid UTF-8 bytes are converted into lone surrogates \udc80 - \udcff like surrogateescape of Python,
+// so os.fsencode() restores the original bytes.
+func PyQuote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			fmt.Fprintf(&b, `\u%04x`, 0xdc00+int(s[i]))
+			i++
+			continue
+		}
+		i += size
+		switch r {
+		case '\\':
+			b.WriteString(`\\`)
+		case '"':
+			b.WriteString(`\"`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			switch {
+			case r < 0x20 || r == 0x7f:
+				fmt.Fprintf(&b, `\x%02x`, r)
+			case !unicode.IsPrint(r) && r <= 0xffff:
+				fmt.Fprintf(&b, `\u%04x`, r)
+			case !unicode.IsPrint(r):
+				fmt.Fprintf(&b, `\U%08x`, r)
+			default:
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// RustQuote returns a Rust string literal of s.
+// Invalid UTF-8 bytes are replaced with U+FFFD because a Rust string is UTF-8.
+func RustQuote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s { // invalid bytes are decoded as utf8.RuneError, U+FFFD
+		switch r {
+		case '\\':
+			b.WriteString(`\\`)
+		case '"':
+			b.WriteString(`\"`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case 0:
+			b.WriteString(`\0`)
+		default:
+			if unicode.IsPrint(r) {
+				b.WriteRune(r)
+			} else {
+				fmt.Fprintf(&b, `\u{%x}`, r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// ShJoin quotes each of v by [ShQuote] and joins them by space.
+func ShJoin(v []string) string {
+	xs := make([]string, len(v))
+	for i, x := range v {
+		xs[i] = ShQuote(x)
+	}
+	return strings.Join(xs, " ")
+}
@@ -0,0 +1,121 @@
+package linep_test
+
+import (
+	"testing"
+
+	"github.com/berquerant/linep"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeCode(t *testing.T) {
+	for _, tc := range []struct {
+		title    string
+		input    string
+		tabWidth int
+		want     string
+	}{
+		{title: "empty", input: "", want: ""},
+		{title: "blank", input: "\n  \n", want: ""},
+		{title: "single", input: "print(x)", want: "print(x)"},
+		{title: "dedent", input: "    if x:\n        print(x)", want: "if x:\n    print(x)"},
+		{title: "blank lines", input: "\n\n  a\n\n    b\n  \n", want: "a\n\n  b"},
+		{title: "no common indent", input: "if x:\n  print(x)", want: "if x:\n  print(x)"},
+		{title: "keep tabs", input: "\t\ta\n\t\t\tb", want: "a\n\tb"},
+		{title: "tabs", input: "\ta\n\t\tb", tabWidth: 4, want: "a\n    b"},
+		{title: "mixed tabs", input: "    a\n\tb", tabWidth: 4, want: "a\nb"},
+		{title: "mixed without tab width", input: "    a\n\tb", want: "    a\n\tb"},
+		{title: "tab in body", input: "  a\tb", tabWidth: 4, want: "a\tb"},
+		{title: "crlf", input: "  a\r\n  b", want: "a\nb"},
+	} {
+		t.Run(tc.title, func(t *testing.T) {
+			assert.Equal(t, tc.want, linep.NormalizeCode(tc.input, tc.tabWidth))
+		})
+	}
+}
+
+func TestReindent(t *testing.T) {
+	assert.Equal(t, "\n  a\n\n    b", linep.Reindent(2, "a\n\n  b"))
+}
+
+func TestQuote(t *testing.T) {
+	for _, tc := range []struct {
+		title string
+		input string
+		sh    string
+		goq   string
+		py    string
+		rust  string
+	}{
+		{
+			title: "empty",
+			input: "",
+			sh:    `''`,
+			goq:   `""`,
+			py:    `""`,
+			rust:  `""`,
+		},
+		{
+			title: "quotes",
+			input: `it's "q"`,
+			sh:    `'it'\''s "q"'`,
+			goq:   `"it's \"q\""`,
+			py:    `"it's \"q\""`,
+			rust:  `"it's \"q\""`,
+		},
+		{
+			title: "backslash",
+			input: `a\b\\`,
+			sh:    `'a\b\\'`,
+			goq:   `"a\\b\\\\"`,
+			py:    `"a\\b\\\\"`,
+			rust:  `"a\\b\\\\"`,
+		},
+		{
+			title: "newlines and tabs",
+			input: "a\nb\r\tc",
+			sh:    "'a\nb\r\tc'",
+			goq:   `"a\nb\r\tc"`,
+			py:    `"a\nb\r\tc"`,
+			rust:  `"a\nb\r\tc"`,
+		},
+		{
+			title: "control",
+			input: "\x00\x1b\x7f",
+			sh:    "'\x00\x1b\x7f'",
+			goq:   `"\x00\x1b\x7f"`,
+			py:    `"\x00\x1b\x7f"`,
+			rust:  `"\0\u{1b}\u{7f}"`,
+		},
+		{
+			title: "unicode",
+			input: "あ\u200b😀",
+			sh:    "'あ\u200b😀'",
+			goq:   `"あ\u200b😀"`,
+			py:    `"あ\u200b😀"`,
+			rust:  `"あ\u{200b}😀"`,
+		},
+		{
+			title: "regexp",
+			input: `^\d+\s*$`,
+			sh:    `'^\d+\s*$'`,
+			goq:   `"^\\d+\\s*$"`,
+			py:    `"^\\d+\\s*$"`,
+			rust:  `"^\\d+\\s*$"`,
+		},
+		{
+			title: "invalid utf8",
+			input: "a\xff\xc3b",
+			sh:    "'a\xff\xc3b'",
+			goq:   `"a\xff\xc3b"`,
+			py:    `"a\udcff\udcc3b"`,
+			rust:  `"a��b"`,
+		},
+	} {
+		t.Run(tc.title, func(t *testing.T) {
+			assert.Equal(t, tc.sh, linep.ShQuote(tc.input), "sh")
+			assert.Equal(t, tc.goq, linep.GoQuote(tc.input), "go")
+			assert.Equal(t, tc.py, linep.PyQuote(tc.input), "python")
+			assert.Equal(t, tc.rust, linep.RustQuote(tc.input), "rust")
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package linep
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+const (
+	colorReset   = "\x1b[0m"
+	colorKeyword = "\x1b[35m"
+	colorString  = "\x1b[32m"
+	colorNumber  = "\x1b[36m"
+	colorComment = "\x1b[90m"
+)
+
+// IsColorEnabled reports true if f is a terminal and NO_COLOR is not set.
+func IsColorEnabled(f *os.File) bool {
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return false
+	}
+	x, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return x.Mode()&os.ModeCharDevice != 0
+}
+
+type syntax struct {
+	keywords     []string
+	lineComment  string
+	blockComment [2]string
+	// quotes are delimiters of string literals, longer first.
+	quotes []string
+	// rawQuote has no escape sequences.
+	rawQuote string
+}
+
+var syntaxByLang = map[string]syntax{
+	LangGo: {
+		keywords: []string{
+			"break", "case", "chan", "const", "continue", "default", "defer", "else", "fallthrough",
+			"for", "func", "go", "goto", "if", "import", "interface", "map", "package", "range",
+			"return", "select", "struct", "switch", "type", "var",
+			"nil", "true", "false", "iota",
+		},
+		lineComment:  "//",
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       []string{`"`, "'", "`"},
+		rawQuote:     "`",
+	},
+	LangPython: {
+		keywords: []string{
+			"False", "None", "True", "and", "as", "assert", "async", "await", "break", "class",
+			"continue", "def", "del", "elif", "else", "except", "finally", "for", "from", "global",
+			"if", "import", "in", "is", "lambda", "nonlocal", "not", "or", "pass", "raise",
+			"return", "try", "while", "with", "yield",
+		},
+		lineComment: "#",
+		quotes:      []string{`"""`, `'''`, `"`, "'"},
+	},
+	LangRust: {
+		keywords: []string{
+			"as", "async", "await", "break", "const", "continue", "crate", "dyn", "else", "enum",
+			"extern", "false", "fn", "for", "if", "impl", "in", "let", "loop", "match", "mod",
+			"move", "mut", "pub", "ref", "return", "self", "Self", "static", "struct", "super",
+			"trait", "true", "type", "unsafe", "use", "where", "while",
+		},
+		lineComment:  "//",
+		blockComment: [2]string{"/*", "*/"},
+		// ' is also a lifetime
+		quotes: []string{`"`},
+	},
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// Highlight writes src colored by the syntax of lang with ANSI escape sequences.
+// src is written as is if lang is unknown.
+func Highlight(w io.Writer, lang, src string) error {
+	x, ok := syntaxByLang[lang]
+	if !ok {
+		_, err := io.WriteString(w, src)
+		return err
+	}
+
+	var (
+		b     = bufio.NewWriter(w)
+		color = func(c, s string) {
+			// color each line not to break colors by line based pagers
+			for i, line := range strings.Split(s, "\n") {
+				if i > 0 {
+					_ = b.WriteByte('\n')
+				}
+				if line != "" {
+					_, _ = b.WriteString(c + line + colorReset)
+				}
+			}
+		}
+		// until returns the index after end from i of src, or the end of src.
+		until = func(i int, end string, escape bool) int {
+			for j := i; j < len(src); j++ {
+				switch {
+				case escape && src[j] == '\\':
+					j++
+				case strings.HasPrefix(src[j:], end):
+					return j + len(end)
+				case len(end) == 1 && end != x.rawQuote && src[j] == '\n':
+					// unterminated
+					return j
+				}
+			}
+			return len(src)
+		}
+	)
+
+	for i := 0; i < len(src); {
+		rest := src[i:]
+		switch {
+		case x.lineComment != "" && strings.HasPrefix(rest, x.lineComment):
+			j := strings.IndexByte(rest, '\n')
+			if j < 0 {
+				j = len(rest)
+			}
+			color(colorComment, rest[:j])
+			i += j
+			continue
+		case x.blockComment[0] != "" && strings.HasPrefix(rest, x.blockComment[0]):
+			j := until(i+len(x.blockComment[0]), x.blockComment[1], false)
+			color(colorComment, src[i:j])
+			i = j
+			continue
+		}
+		if q, ok := prefixOf(rest, x.quotes); ok {
+			j := until(i+len(q), q, q != x.rawQuote)
+			color(colorString, src[i:j])
+			i = j
+			continue
+		}
+		if !isIdentByte(src[i]) {
+			_ = b.WriteByte(src[i])
+			i++
+			continue
+		}
+		j := i
+		for j < len(src) && isIdentByte(src[j]) {
+			j++
+		}
+		switch word := src[i:j]; {
+		case isDigit(word[0]):
+			color(colorNumber, word)
+		case slices.Contains(x.keywords, word):
+			color(colorKeyword, word)
+		default:
+			_, _ = b.WriteString(word)
+		}
+		i = j
+	}
+	return b.Flush()
+}
+
+func prefixOf(s string, prefixes []string) (string, bool) {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return p, true
+		}
+	}
+	return "", false
+}
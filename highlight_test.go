@@ -0,0 +1,68 @@
+package linep_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/berquerant/linep"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHighlight(t *testing.T) {
+	const (
+		reset   = "\x1b[0m"
+		keyword = "\x1b[35m"
+		str     = "\x1b[32m"
+		number  = "\x1b[36m"
+		comment = "\x1b[90m"
+	)
+	for _, tc := range []struct {
+		title string
+		lang  string
+		src   string
+		want  string
+	}{
+		{
+			title: "unknown",
+			lang:  "",
+			src:   "if x:\n  pass",
+			want:  "if x:\n  pass",
+		},
+		{
+			title: "go",
+			lang:  linep.LangGo,
+			src:   "if x == \"a\\\"b\" { // c\n\treturn 10\n}",
+			want:  keyword + "if" + reset + " x == " + str + `"a\"b"` + reset + " { " + comment + "// c" + reset + "\n\t" + keyword + "return" + reset + " " + number + "10" + reset + "\n}",
+		},
+		{
+			title: "go raw string",
+			lang:  linep.LangGo,
+			src:   "`a\nb`",
+			want:  str + "`a" + reset + "\n" + str + "b`" + reset,
+		},
+		{
+			title: "python",
+			lang:  linep.LangPython,
+			src:   "def f(): # x\n    '''a\n    b'''",
+			want:  keyword + "def" + reset + " f(): " + comment + "# x" + reset + "\n    " + str + "'''a" + reset + "\n" + str + "    b'''" + reset,
+		},
+		{
+			title: "rust lifetime",
+			lang:  linep.LangRust,
+			src:   "fn f<'a>(x: &'a str) /* c */",
+			want:  keyword + "fn" + reset + " f<'a>(x: &'a str) " + comment + "/* c */" + reset,
+		},
+		{
+			title: "unterminated",
+			lang:  linep.LangGo,
+			src:   "x := \"a\ny",
+			want:  "x := " + str + `"a` + reset + "\ny",
+		},
+	} {
+		t.Run(tc.title, func(t *testing.T) {
+			var b bytes.Buffer
+			assert.Nil(t, linep.Highlight(&b, tc.lang, tc.src))
+			assert.Equal(t, tc.want, b.String())
+		})
+	}
+}
@@ -0,0 +1,243 @@
+package linep
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidHistory = errors.New("InvalidHistory")
+)
+
+// HistoryEntry is a run of linep.
+type HistoryEntry struct {
+	ID   int       `json:"id"`
+	Time time.Time `json:"time"`
+	// Dir is the current directory of the run.
+	Dir      string `json:"dir"`
+	Template string `json:"template"`
+	// Args are the command-line arguments without the command name,
+	// values of --env are removed.
+	Args       []string      `json:"args"`
+	Import     []string      `json:"import,omitempty"`
+	Duration   time.Duration `json:"duration"`
+	ExitStatus int           `json:"exitStatus"`
+}
+
+// CommandLine returns the shell command of the run.
+func (h HistoryEntry) CommandLine() string {
+	return shellCommandLine(h.Args)
+}
+
+// shellCommandLine returns the shell command of linep with args, quoted if needed.
+func shellCommandLine(args []string) string {
+	xs := []string{"linep"}
+	for _, x := range args {
+		if !shellSafe.MatchString(x) {
+			x = ShQuote(x)
+		}
+		xs = append(xs, x)
+	}
+	return strings.Join(xs, " ")
+}
+
+// Match reports true if the command line or the directory contains all of the terms, ignoring case.
+func (h HistoryEntry) Match(terms []string) bool {
+	s := strings.ToLower(h.CommandLine() + "\n" + h.Dir)
+	for _, x := range terms {
+		if !strings.Contains(s, strings.ToLower(x)) {
+			return false
+		}
+	}
+	return true
+}
+
+// ExitStatus returns the exit status of the error of the run.
+func ExitStatus(err error) int {
+	if err == nil {
+		return 0
+	}
+	var x *exec.ExitError
+	if errors.As(err, &x) && x.ExitCode() > 0 {
+		return x.ExitCode()
+	}
+	return 1
+}
+
+// HistoryRotateSize is the size of the history file to rotate it into history.jsonl.1,
+// the rotated one is overwritten.
+var HistoryRotateSize int64 = 4 << 20
+
+func historyFile(workDir string) string {
+	return filepath.Join(workDir, "history.jsonl")
+}
+
+func rotatedHistoryFile(workDir string) string {
+	return historyFile(workDir) + ".1"
+}
+
+// ReadHistory reads the history in workDir including the rotated one, oldest first.
+// Invalid lines are skipped with a warning.
+func ReadHistory(workDir string) ([]HistoryEntry, error) {
+	var r []HistoryEntry
+	for _, name := range []string{rotatedHistoryFile(workDir), historyFile(workDir)} {
+		xs, err := readHistoryFile(name)
+		if err != nil {
+			return nil, err
+		}
+		r = append(r, xs...)
+	}
+	return r, nil
+}
+
+func readHistoryFile(name string) ([]HistoryEntry, error) {
+	f, err := os.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		r       []HistoryEntry
+		scanner = bufio.NewScanner(f)
+	)
+	scanner.Buffer(nil, 16*1024*1024)
+	for i := 1; scanner.Scan(); i++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var x HistoryEntry
+		if err := json.Unmarshal(scanner.Bytes(), &x); err != nil {
+			slog.Warn("skip invalid history", slog.String("file", name), slog.Int("line", i), WithErr(err))
+			continue
+		}
+		r = append(r, x)
+	}
+	return r, scanner.Err()
+}
+
+// FindHistory returns the entry of the history in workDir by ID.
+func FindHistory(workDir string, id int) (*HistoryEntry, error) {
+	xs, err := ReadHistory(workDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, x := range xs {
+		if x.ID == id {
+			return &x, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: unknown id: %d", ErrInvalidHistory, id)
+}
+
+// AppendHistory appends the entry to the history in workDir with the next ID.
+// The history is locked while appending, and rotated if it exceeds [HistoryRotateSize].
+func AppendHistory(workDir string, entry HistoryEntry) error {
+	if err := os.MkdirAll(workDir, 0755); err != nil {
+		return err
+	}
+	unlock, err := lockFile(filepath.Join(workDir, "history.lock"))
+	if err != nil {
+		return fmt.Errorf("%w: lock history", err)
+	}
+	defer unlock()
+
+	name := historyFile(workDir)
+	if info, err := os.Stat(name); err == nil && info.Size() >= HistoryRotateSize {
+		if err := os.Rename(name, rotatedHistoryFile(workDir)); err != nil {
+			return fmt.Errorf("%w: rotate history", err)
+		}
+	}
+	id, err := lastHistoryID(workDir)
+	if err != nil {
+		return err
+	}
+	entry.ID = id + 1
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = fmt.Fprintf(f, "%s\n", b)
+	return err
+}
+
+// lastHistoryID returns the ID of the last entry of the history, 0 if empty.
+func lastHistoryID(workDir string) (int, error) {
+	for _, name := range []string{historyFile(workDir), rotatedHistoryFile(workDir)} {
+		line, err := lastLine(name)
+		if err != nil {
+			return 0, err
+		}
+		if len(line) == 0 {
+			continue
+		}
+		var x HistoryEntry
+		if err := json.Unmarshal(line, &x); err == nil {
+			return x.ID, nil
+		}
+		// the last line is broken, fall back to the valid entries
+		xs, err := ReadHistory(workDir)
+		if err != nil {
+			return 0, err
+		}
+		var id int
+		for _, x := range xs {
+			id = max(id, x.ID)
+		}
+		return id, nil
+	}
+	return 0, nil
+}
+
+// lastLine returns the last non-empty line of the file, nil if the file does not exist.
+func lastLine(name string) ([]byte, error) {
+	f, err := os.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	const chunkSize = 4096
+	var (
+		buf []byte
+		off = info.Size()
+	)
+	for off > 0 {
+		n := min(off, chunkSize)
+		off -= n
+		chunk := make([]byte, n)
+		if _, err := f.ReadAt(chunk, off); err != nil {
+			return nil, err
+		}
+		buf = append(chunk, buf...)
+		x := bytes.TrimRight(buf, "\n")
+		if i := bytes.LastIndexByte(x, '\n'); i >= 0 {
+			return x[i+1:], nil
+		}
+	}
+	return bytes.TrimRight(buf, "\n"), nil
+}
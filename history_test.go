@@ -0,0 +1,136 @@
+package linep_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/berquerant/linep"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistory(t *testing.T) {
+	workDir := t.TempDir()
+	xs, err := linep.ReadHistory(workDir)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, 0, len(xs))
+
+	for _, x := range [][]string{
+		{"go", "fmt.Println(x)"},
+		{"py", "print(x.upper())", "--", "a b"},
+	} {
+		if !assert.Nil(t, linep.AppendHistory(workDir, linep.HistoryEntry{
+			Time: time.Now(),
+			Dir:  "/tmp/Project",
+			Args: x,
+		})) {
+			return
+		}
+	}
+	xs, err = linep.ReadHistory(workDir)
+	if !assert.Nil(t, err) || !assert.Equal(t, 2, len(xs)) {
+		return
+	}
+	assert.Equal(t, 1, xs[0].ID)
+	assert.Equal(t, 2, xs[1].ID)
+	assert.Equal(t, "linep py 'print(x.upper())' -- 'a b'", xs[1].CommandLine())
+
+	t.Run("match", func(t *testing.T) {
+		assert.True(t, xs[1].Match(nil))
+		assert.True(t, xs[1].Match([]string{"UPPER", "py"}))
+		assert.True(t, xs[1].Match([]string{"project"}))
+		assert.False(t, xs[1].Match([]string{"upper", "go"}))
+	})
+
+	t.Run("find", func(t *testing.T) {
+		x, err := linep.FindHistory(workDir, 2)
+		if assert.Nil(t, err) {
+			assert.Equal(t, xs[1].Args, x.Args)
+		}
+		_, err = linep.FindHistory(workDir, 3)
+		assert.ErrorIs(t, err, linep.ErrInvalidHistory)
+	})
+}
+
+func TestHistoryInvalidLine(t *testing.T) {
+	workDir := t.TempDir()
+	if !assert.Nil(t, linep.AppendHistory(workDir, linep.HistoryEntry{Args: []string{"go"}})) {
+		return
+	}
+	f, err := os.OpenFile(filepath.Join(workDir, "history.jsonl"), os.O_APPEND|os.O_WRONLY, 0600)
+	if !assert.Nil(t, err) {
+		return
+	}
+	_, err = f.WriteString("{broken\n")
+	assert.Nil(t, err)
+	assert.Nil(t, f.Close())
+
+	if !assert.Nil(t, linep.AppendHistory(workDir, linep.HistoryEntry{Args: []string{"py"}})) {
+		return
+	}
+	xs, err := linep.ReadHistory(workDir)
+	if assert.Nil(t, err) && assert.Equal(t, 2, len(xs)) {
+		assert.Equal(t, 1, xs[0].ID)
+		assert.Equal(t, 2, xs[1].ID)
+	}
+}
+
+func TestHistoryRotate(t *testing.T) {
+	defer func(x int64) { linep.HistoryRotateSize = x }(linep.HistoryRotateSize)
+	linep.HistoryRotateSize = 1
+
+	workDir := t.TempDir()
+	for range 3 {
+		if !assert.Nil(t, linep.AppendHistory(workDir, linep.HistoryEntry{Args: []string{"go"}})) {
+			return
+		}
+	}
+	xs, err := linep.ReadHistory(workDir)
+	if assert.Nil(t, err) && assert.Equal(t, 2, len(xs)) {
+		assert.Equal(t, 2, xs[0].ID)
+		assert.Equal(t, 3, xs[1].ID)
+	}
+}
+
+func TestHistoryConcurrent(t *testing.T) {
+	const n = 20
+	var (
+		workDir = t.TempDir()
+		wg      sync.WaitGroup
+	)
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Nil(t, linep.AppendHistory(workDir, linep.HistoryEntry{Args: []string{"go"}}))
+		}()
+	}
+	wg.Wait()
+	xs, err := linep.ReadHistory(workDir)
+	if !assert.Nil(t, err) || !assert.Equal(t, n, len(xs)) {
+		return
+	}
+	ids := map[int]bool{}
+	for _, x := range xs {
+		ids[x.ID] = true
+	}
+	assert.Equal(t, n, len(ids))
+}
+
+func TestExitStatus(t *testing.T) {
+	assert.Equal(t, 0, linep.ExitStatus(nil))
+	assert.Equal(t, 1, linep.ExitStatus(errors.New("err")))
+}
+
+func TestRedactEnvArgs(t *testing.T) {
+	assert.Equal(t,
+		[]string{"go", "--env", "TOKEN", "--env=KEY", "--env", "HOME", "--", "--env", "A=b"},
+		linep.RedactEnvArgs([]string{"go", "--env", "TOKEN=secret", "--env=KEY=v=w", "--env", "HOME", "--", "--env", "A=b"}),
+	)
+	assert.Equal(t, []string{"TOKEN", "HOME"}, linep.RedactEnv([]string{"TOKEN=secret", "HOME"}))
+}
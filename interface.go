@@ -1,40 +1,761 @@
 package linep
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"maps"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
 
-	"github.com/berquerant/structconfig"
 	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
 )
 
-func NewConfig(fs *pflag.FlagSet) (*Config, error) {
+// arrayFlags are the flags can be specified multiple times.
+type arrayFlags struct {
+	templateSet   *[]string
+	templatePatch *[]string
+	env           *[]string
+	envFile       *[]string
+	templatePath  *[]string
+}
+
+func setFlags(fs *pflag.FlagSet) (*arrayFlags, error) {
 	var b Config
-	config, err := structconfig.NewConfigWithMerge(b.StructConfig(), b.Merger(), fs)
+	if err := b.StructConfig().SetFlags(fs); err != nil {
+		return nil, err
+	}
+	return &arrayFlags{
+		templateSet:   fs.StringArray("template-set", nil, "override a template field by field=value like 'exec=go run @MAIN' or 'macros.NAME=value'; can be specified multiple times"),
+		templatePatch: fs.StringArray("template-patch", nil, "merge a template yaml file into the template; can be specified multiple times"),
+		env:           fs.StringArray("env", nil, "set an environment variable of steps by KEY=VALUE, or pass KEY from the environment; can be specified multiple times"),
+		envFile:       fs.StringArray("env-file", nil, "read environment variables of steps from a file of KEY=VALUE lines; can be specified multiple times"),
+		templatePath:  fs.StringArray("template-path", nil, "search TEMPLATE.yml or TEMPLATE.yaml in the directory, the latter takes precedence; can be specified multiple times"),
+	}, nil
+}
+
+const (
+	envSourceName   = "environment variables"
+	flagsSourceName = "flags"
+)
+
+// flagSource is flag arguments from a source of the config.
+type flagSource struct {
+	name string
+	args []string
+}
+
+// newQuietFlagSet returns a flag set to read flags before parsing, it does not report errors.
+func newQuietFlagSet(name string) (*pflag.FlagSet, error) {
+	fs := pflag.NewFlagSet(name, pflag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.Usage = func() {}
+	if _, err := setFlags(fs); err != nil {
+		return nil, err
+	}
+	return fs, nil
+}
+
+// flagSources returns the flag arguments of the config file, the profile, the project file,
+// the profile of the project file and the environment variables in order, the latter takes precedence.
+// args are the command-line arguments.
+// It also returns the config file and the project file read.
+func flagSources(fs *pflag.FlagSet, args []string, project bool) ([]flagSource, []*ConfigFile, error) {
+	// find the config file and the profile before parsing
+	pre, err := newQuietFlagSet(fs.Name())
+	if err != nil {
+		return nil, nil, err
+	}
+	// fs reports errors
+	_ = pre.Parse(envArgs(pre))
+	_ = pre.Parse(args)
+
+	configFile, _ := pre.GetString("config")
+	required := configFile != ""
+	if !required {
+		x, err := DefaultConfigFile()
+		if err != nil {
+			return nil, nil, err
+		}
+		configFile = x
+	}
+	c, err := ReadConfigFile(configFile, required)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: config file %s", err, configFile)
+	}
+	profile, _ := pre.GetString("profile")
+	if profile == "" {
+		profile = c.Profile
+	}
+
+	var (
+		sources []flagSource
+		files   = []*ConfigFile{c}
+		found   bool
+	)
+	add := func(file *ConfigFile, name string) error {
+		x, err := file.valueArgs(fs)
+		if err != nil {
+			return fmt.Errorf("%w: %s", err, name)
+		}
+		sources = append(sources, flagSource{name: name, args: x})
+		if profile == "" {
+			return nil
+		}
+		x, ok, err := file.profileArgs(fs, profile)
+		if err != nil {
+			return fmt.Errorf("%w: %s", err, name)
+		}
+		if ok {
+			found = true
+			sources = append(sources, flagSource{name: fmt.Sprintf("profile %s of %s", profile, name), args: x})
+		}
+		return nil
+	}
+	if err := add(c, "config file "+configFile); err != nil {
+		return nil, nil, err
+	}
+	env := flagSource{name: envSourceName, args: envArgs(fs)}
+
+	if project {
+		// the workdir recording trust is not affected by the project file
+		workDir, err := parseWorkDir(fs.Name(), args, append(slices.Clone(sources), env))
+		if err != nil {
+			return nil, nil, err
+		}
+		pwd, err := os.Getwd()
+		if err != nil {
+			return nil, nil, err
+		}
+		if name, ok := FindProjectFile(pwd); ok {
+			p, err := ReadProjectFile(workDir, name)
+			switch {
+			case errors.Is(err, ErrUntrusted):
+				// a project file of others like a cloned repository should not break linep
+				slog.Warn("skip untrusted project file", WithErr(err))
+			case err != nil:
+				return nil, nil, err
+			default:
+				if err := add(p, "project file "+name); err != nil {
+					return nil, nil, err
+				}
+				files = append(files, p)
+			}
+		}
+	}
+	if profile != "" && !found {
+		return nil, nil, fmt.Errorf("%w: unknown profile: %s", ErrInvalidConfigFile, profile)
+	}
+	return append(sources, env), files, nil
+}
+
+// parseWorkDir returns the absolute workdir from the sources and the command-line arguments.
+func parseWorkDir(name string, args []string, sources []flagSource) (string, error) {
+	fs, err := newQuietFlagSet(name)
+	if err != nil {
+		return "", err
+	}
+	for _, x := range sources {
+		_ = fs.Parse(x.args)
+	}
+	_ = fs.Parse(args)
+	x, _ := fs.GetString("workDir")
+	return absWorkDir(x)
+}
+
+// parseFlags parses the sources of the config and the command-line arguments in order, the latter takes precedence.
+// Flags can be specified multiple times accumulate values.
+// It returns the sources parsed.
+func parseFlags(fs *pflag.FlagSet, args []string, project bool) ([]flagSource, error) {
+	sources, _, err := flagSources(fs, args, project)
+	if err != nil {
+		return nil, err
+	}
+	for _, x := range sources {
+		if err := fs.Parse(x.args); err != nil {
+			return nil, fmt.Errorf("%w: %s", err, x.name)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	return append(sources, flagSource{name: flagsSourceName, args: args}), nil
+}
+
+// TrustProject trusts the project file, FILE argument of "linep trust [FILE]"
+// or the project file found from the current directory.
+func TrustProject(fs *pflag.FlagSet) (string, error) {
+	if _, err := setFlags(fs); err != nil {
+		return "", err
+	}
+	if _, err := parseFlags(fs, os.Args, false); err != nil {
+		return "", err
+	}
+	x, _ := fs.GetString("workDir")
+	workDir, err := absWorkDir(x)
+	if err != nil {
+		return "", err
+	}
+
+	var name string
+	switch args := fs.Args(); len(args) {
+	case 2:
+		pwd, err := os.Getwd()
+		if err != nil {
+			return "", err
+		}
+		x, ok := FindProjectFile(pwd)
+		if !ok {
+			return "", fmt.Errorf("%w: %s is not found", ErrInvalidConfigFile, ProjectFileName)
+		}
+		name = x
+	case 3:
+		name = args[2]
+	default:
+		return "", fmt.Errorf("require 0 or 1 positional argument: args: %v positional: %v", os.Args, args)
+	}
+	return name, Trust(workDir, name)
+}
+
+// ConfigValue is a value of the config and its source.
+type ConfigValue struct {
+	Value any `json:"value" yaml:"value"`
+	// Source is default, config file, profile, project file, environment variable or flags.
+	// Sources of the flags can be specified multiple times are joined by ", ".
+	Source string `json:"source" yaml:"source"`
+}
+
+// ShowConfig writes the values of the flags and their sources for "linep config show".
+func ShowConfig(fs *pflag.FlagSet, w io.Writer) error {
+	if _, err := setFlags(fs); err != nil {
+		return err
+	}
+	sources, err := parseFlags(fs, os.Args, true)
+	if err != nil {
+		return err
+	}
+	if args := fs.Args(); len(args) != 3 {
+		return fmt.Errorf("require no positional arguments: args: %v positional: %v", os.Args, args)
+	}
+
+	// flag name to the names of the sources setting it
+	set := map[string][]string{}
+	for _, x := range sources {
+		q, err := newQuietFlagSet(fs.Name())
+		if err != nil {
+			return err
+		}
+		_ = q.Parse(x.args)
+		q.Visit(func(f *pflag.Flag) {
+			name := x.name
+			if name == envSourceName {
+				name = "environment variable " + EnvName(f.Name)
+			}
+			set[f.Name] = append(set[f.Name], name)
+		})
+	}
+
+	values := map[string]ConfigValue{}
+	var visitErr error
+	fs.VisitAll(func(f *pflag.Flag) {
+		v := ConfigValue{
+			Source: "default",
+		}
+		if xs := set[f.Name]; len(xs) > 0 {
+			if f.Value.Type() == "stringArray" {
+				v.Source = strings.Join(slices.Compact(xs), ", ")
+			} else {
+				v.Source = xs[len(xs)-1]
+			}
+		}
+		switch {
+		case f.Value.Type() == "bool":
+			v.Value, _ = fs.GetBool(f.Name)
+		case f.Value.Type() == "stringArray":
+			v.Value, _ = fs.GetStringArray(f.Name)
+		case f.Name == "workDir":
+			x, err := absWorkDir(f.Value.String())
+			if err != nil {
+				visitErr = err
+			}
+			v.Value = x
+		default:
+			if sep, ok := listSeparators[f.Name]; ok && f.Value.String() != "" {
+				v.Value = strings.Split(f.Value.String(), sep)
+			} else {
+				v.Value = f.Value.String()
+			}
+		}
+		values[f.Name] = v
+	})
+	if visitErr != nil {
+		return visitErr
+	}
+
+	if x, _ := fs.GetBool("json"); x {
+		b, err := json.MarshalIndent(values, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", b)
+		return err
+	}
+	b, err := yaml.Marshal(values)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s", b)
+	return err
+}
+
+// loadSnippets returns the snippets of the snippets file, the config file and the project file,
+// the latter takes precedence.
+func loadSnippets(fs *pflag.FlagSet, args []string) (Snippets, error) {
+	_, files, err := flagSources(fs, args, true)
+	if err != nil {
+		return nil, err
+	}
+	name, err := DefaultSnippetsFile()
+	if err != nil {
+		return nil, err
+	}
+	s, err := ReadSnippetsFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: snippets file %s", err, name)
+	}
+	for _, f := range files {
+		s.Merge(f.Snippets)
+	}
+	return s, nil
+}
+
+// cutDescription removes --description DESC or --description=DESC before -- from args.
+func cutDescription(args []string) (string, []string) {
+	var (
+		desc string
+		r    []string
+	)
+	for i := 0; i < len(args); i++ {
+		switch x := args[i]; {
+		case x == "--":
+			return desc, append(r, args[i:]...)
+		case x == "--description" && i+1 < len(args):
+			desc = args[i+1]
+			i++
+		case strings.HasPrefix(x, "--description="):
+			desc = strings.TrimPrefix(x, "--description=")
+		default:
+			r = append(r, x)
+		}
+	}
+	return desc, r
+}
+
+// SaveSnippet saves the arguments of "linep save NAME [--description DESC] TEMPLATE ..." into the snippets file.
+// It returns the name of the snippet.
+func SaveSnippet(fs *pflag.FlagSet) (string, error) {
+	if len(os.Args) < 3 {
+		return "", fmt.Errorf("%w: require NAME", ErrInvalidSnippet)
+	}
+	name := os.Args[2]
+	if err := ValidateSnippetName(name); err != nil {
+		return "", err
+	}
+	desc, args := cutDescription(os.Args[3:])
+	// validate flags
+	if _, err := setFlags(fs); err != nil {
+		return "", err
+	}
+	if err := fs.Parse(args); err != nil {
+		return "", err
+	}
+	if len(fs.Args()) == 0 {
+		return "", fmt.Errorf("%w: require TEMPLATE", ErrInvalidSnippet)
+	}
+
+	file, err := DefaultSnippetsFile()
+	if err != nil {
+		return "", err
+	}
+	s, err := ReadSnippetsFile(file)
+	if err != nil {
+		return "", fmt.Errorf("%w: snippets file %s", err, file)
+	}
+	s[name] = Snippet{
+		Description: desc,
+		Args:        args,
+	}
+	if err := WriteSnippetsFile(file, s); err != nil {
+		return "", fmt.Errorf("%w: snippets file %s", err, file)
+	}
+	return name, nil
+}
+
+// ListSnippets writes the names and the descriptions of the snippets, or the snippet NAME of "linep snippets [NAME]".
+func ListSnippets(fs *pflag.FlagSet, w io.Writer) error {
+	if _, err := setFlags(fs); err != nil {
+		return err
+	}
+	s, err := loadSnippets(fs, os.Args)
+	if err != nil {
+		return err
+	}
+	if err := fs.Parse(os.Args); err != nil {
+		return err
+	}
+
+	switch args := fs.Args(); len(args) {
+	case 2:
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		for _, name := range slices.Sorted(maps.Keys(s)) {
+			fmt.Fprintf(tw, "%s\t%s\n", name, s[name].Description)
+		}
+		return tw.Flush()
+	case 3:
+		x, ok := s[args[2]]
+		if !ok {
+			return fmt.Errorf("%w: unknown snippet: %s", ErrInvalidSnippet, args[2])
+		}
+		b, err := yaml.Marshal(Snippets{args[2]: x})
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s", b)
+		return err
+	default:
+		return fmt.Errorf("require 0 or 1 positional argument: args: %v positional: %v", os.Args, args)
+	}
+}
+
+// insertArgs inserts extra into base, flags of extra before -- of base and arguments after -- of extra at the end.
+func insertArgs(base, extra []string) []string {
+	i := slices.Index(base, "--")
+	if i < 0 {
+		i = len(base)
+	}
+	j := slices.Index(extra, "--")
+	if j < 0 {
+		j = len(extra)
+	}
+	r := slices.Concat(base[:i], extra[:j], base[i:])
+	if j < len(extra) {
+		if i == len(base) {
+			r = append(r, "--")
+		}
+		r = append(r, extra[j+1:]...)
+	}
+	return r
+}
+
+// NewSnippetConfig returns the config of "linep run NAME [key=value...] [FLAGS] [-- ARGS...]".
+// FLAGS and ARGS are added to the arguments of the snippet.
+func NewSnippetConfig(fs *pflag.FlagSet) (*Config, error) {
+	if len(os.Args) < 3 {
+		return nil, fmt.Errorf("%w: require NAME", ErrInvalidSnippet)
+	}
+	var (
+		name = os.Args[2]
+		args = os.Args[3:]
+		i    int
+	)
+	for i < len(args) && !strings.HasPrefix(args[i], "-") && strings.Contains(args[i], "=") {
+		i++
+	}
+	values, err := ParseSnippetValues(args[:i])
 	if err != nil {
 		return nil, err
 	}
 
+	pre, err := newQuietFlagSet(fs.Name())
+	if err != nil {
+		return nil, err
+	}
+	s, err := loadSnippets(pre, os.Args)
+	if err != nil {
+		return nil, err
+	}
+	x, ok := s[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown snippet: %s", ErrInvalidSnippet, name)
+	}
+	filled, err := x.Fill(values)
+	if err != nil {
+		return nil, fmt.Errorf("%w: snippet %s", err, name)
+	}
+	return newConfig(fs, slices.Concat([]string{os.Args[0]}, insertArgs(filled, args[i:])))
+}
+
+// ListHistory writes the runs in the history matching QUERY of "linep history [QUERY...]".
+func ListHistory(fs *pflag.FlagSet, w io.Writer) error {
+	if _, err := setFlags(fs); err != nil {
+		return err
+	}
+	if _, err := parseFlags(fs, os.Args, true); err != nil {
+		return err
+	}
+	x, _ := fs.GetString("workDir")
+	workDir, err := absWorkDir(x)
+	if err != nil {
+		return err
+	}
+	xs, err := ReadHistory(workDir)
+	if err != nil {
+		return err
+	}
+	xs = slices.DeleteFunc(xs, func(h HistoryEntry) bool {
+		return !h.Match(fs.Args()[2:])
+	})
+
+	if x, _ := fs.GetBool("json"); x {
+		if xs == nil {
+			xs = []HistoryEntry{}
+		}
+		b, err := json.MarshalIndent(xs, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", b)
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, h := range xs {
+		fmt.Fprintf(tw, "%d\t%s\t%d\t%s\t%s\n",
+			h.ID,
+			h.Time.Format(time.DateTime),
+			h.ExitStatus,
+			h.Duration.Round(time.Millisecond),
+			h.CommandLine(),
+		)
+	}
+	return tw.Flush()
+}
+
+// CleanCache removes the cache directories of "linep cache clean [DURATION]" not used within DURATION,
+// all if DURATION is omitted, and writes the removed directories.
+func CleanCache(fs *pflag.FlagSet, w io.Writer) error {
+	if _, err := setFlags(fs); err != nil {
+		return err
+	}
+	if _, err := parseFlags(fs, os.Args, true); err != nil {
+		return err
+	}
+	var age time.Duration
+	switch args := fs.Args(); len(args) {
+	case 3:
+	case 4:
+		x, err := time.ParseDuration(args[3])
+		if err != nil {
+			return fmt.Errorf("%w: invalid duration: %s", err, args[3])
+		}
+		age = x
+	default:
+		return fmt.Errorf("require at most DURATION: args: %v positional: %v", os.Args, args)
+	}
+	x, _ := fs.GetString("workDir")
+	workDir, err := absWorkDir(x)
+	if err != nil {
+		return err
+	}
+	xs, err := RemoveCache(workDir, age)
+	for _, x := range xs {
+		if _, err := fmt.Fprintln(w, x); err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// NewHistoryConfig returns the config of "linep history rerun ID [FLAGS] [-- ARGS...]".
+// FLAGS and ARGS are added to the arguments of the run.
+func NewHistoryConfig(fs *pflag.FlagSet) (*Config, error) {
+	if len(os.Args) < 4 {
+		return nil, fmt.Errorf("%w: require ID", ErrInvalidHistory)
+	}
+	id, err := strconv.Atoi(os.Args[3])
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid id: %s", ErrInvalidHistory, os.Args[3])
+	}
+
+	pre, err := newQuietFlagSet(fs.Name())
+	if err != nil {
+		return nil, err
+	}
+	sources, _, err := flagSources(pre, os.Args, true)
+	if err != nil {
+		return nil, err
+	}
+	workDir, err := parseWorkDir(fs.Name(), os.Args, sources)
+	if err != nil {
+		return nil, err
+	}
+	h, err := FindHistory(workDir, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chdir(h.Dir); err != nil {
+		slog.Warn("rerun in the current directory", slog.String("dir", h.Dir), WithErr(err))
+	}
+	return newConfig(fs, slices.Concat([]string{os.Args[0]}, insertArgs(h.Args, os.Args[4:])))
+}
+
+// ReplayBundle runs BUNDLE of "linep replay BUNDLE" again
+// and writes the differences of stdout and the exit status from the recorded ones.
+func ReplayBundle(ctx context.Context, fs *pflag.FlagSet, w io.Writer) error {
+	if _, err := setFlags(fs); err != nil {
+		return err
+	}
+	if _, err := parseFlags(fs, os.Args, true); err != nil {
+		return err
+	}
+	args := fs.Args()
+	if len(args) != 3 {
+		return fmt.Errorf("require BUNDLE: args: %v positional: %v", os.Args, args)
+	}
+	var c Config
+	if err := c.StructConfig().FromFlags(&c, fs); err != nil {
+		return err
+	}
+	if err := c.Initialize(); err != nil {
+		return err
+	}
+	c.SetupLogger()
+
+	b, err := ReadBundle(args[2])
+	if err != nil {
+		return fmt.Errorf("%w: bundle %s", err, args[2])
+	}
+	pwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	return b.Replay(ctx, c.WorkDir, pwd, c.Keep, Stderr(c.Quiet), w)
+}
+
+// NewExportConfig returns the config of "linep export DIR TEMPLATE ...".
+func NewExportConfig(fs *pflag.FlagSet) (*Config, error) {
+	if len(os.Args) < 3 {
+		return nil, fmt.Errorf("%w: require DIR", ErrExport)
+	}
+	c, err := newConfig(fs, slices.Concat(os.Args[:1], os.Args[3:]))
+	if err != nil {
+		return nil, err
+	}
+	c.Export = os.Args[2]
+	return c, nil
+}
+
+// NewScriptConfig returns the config of "linep script FILE [ARGS...]" to run the script file.
+// ARGS are passed to the script.
+func NewScriptConfig(fs *pflag.FlagSet) (*Config, error) {
+	if len(os.Args) < 3 {
+		return nil, fmt.Errorf("%w: require FILE", ErrInvalidScriptFile)
+	}
+	s, err := ReadScriptFile(os.Args[2])
+	if err != nil {
+		return nil, err
+	}
+	q, err := newQuietFlagSet(fs.Name())
+	if err != nil {
+		return nil, err
+	}
+	args, err := s.Args(q)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, os.Args[2])
+	}
+	return newConfig(fs, slices.Concat(os.Args[:1], args, []string{"--"}, os.Args[3:]))
+}
+
+// Share writes the shell command of "linep share TEMPLATE ..." to run it on another machine without files.
+func Share(fs *pflag.FlagSet, w io.Writer) error {
+	c, err := newConfig(fs, slices.Concat(os.Args[:1], os.Args[2:]))
+	if err != nil {
+		return err
+	}
+	x, err := c.ShareCommand()
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, x)
+	return err
+}
+
+func NewConfig(fs *pflag.FlagSet) (*Config, error) {
+	return newConfig(fs, os.Args)
+}
+
+// newConfig returns the config from the command-line arguments, args[0] is the command name.
+func newConfig(fs *pflag.FlagSet, osArgs []string) (*Config, error) {
+	arrays, err := setFlags(fs)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := parseFlags(fs, osArgs, true); err != nil {
+		return nil, err
+	}
+	config := new(Config)
+	if err := config.StructConfig().FromFlags(config, fs); err != nil {
+		return nil, err
+	}
+	config.TemplateSet = *arrays.templateSet
+	config.TemplatePatch = *arrays.templatePatch
+	config.Env = *arrays.env
+	config.EnvFile = *arrays.envFile
+	config.TemplatePath = *arrays.templatePath
+	config.CommandLine = osArgs[1:]
+
 	// positional arguments
-	switch fs.NArg() {
+	args := fs.Args()
+	if i := fs.ArgsLenAtDash(); i >= 0 {
+		// arguments after -- are passed to the script
+		config.Args = args[i:]
+		args = args[:i]
+	}
+	arg := func(i int) string {
+		if i < len(args) {
+			return args[i]
+		}
+		return ""
+	}
+	switch len(args) {
+	case 1, 2: // [LANG], code from files
+		if config.MapFile == "" && !config.DisplayTemplate {
+			return nil, fmt.Errorf(
+				"require MAP or --map-file: args: %v positional: %v",
+				osArgs, fs.Args(),
+			)
+		}
 	case 3: // LANG MAP
-		config.Map = fs.Arg(2)
+		config.Map = arg(2)
 	case 4: // LANG INIT MAP
-		config.Init = fs.Arg(2)
-		config.Map = fs.Arg(3)
+		config.Init = arg(2)
+		config.Map = arg(3)
 	case 5: // LANG INIT MAP REDUCE
-		config.Init = fs.Arg(2)
-		config.Map = fs.Arg(3)
-		config.Reduce = fs.Arg(4)
+		config.Init = arg(2)
+		config.Map = arg(3)
+		config.Reduce = arg(4)
 	default:
 		if !config.DisplayTemplate {
 			return nil, fmt.Errorf(
 				"require 1 - 4 positional arguments: args: %v positional: %v",
-				os.Args, fs.Args(),
+				osArgs, fs.Args(),
 			)
 		}
 	}
-	config.TemplateName = fs.Arg(1)
+	config.TemplateName = arg(1)
+	if err := config.loadCode(os.Stdin); err != nil {
+		return nil, err
+	}
+	if config.TemplateName == "" {
+		return nil, fmt.Errorf("require TEMPLATE: args: %v positional: %v", osArgs, fs.Args())
+	}
 
 	if x, err := os.Getwd(); err == nil {
 		config.PWD = x
@@ -2,10 +2,15 @@ package linep
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"fmt"
+	"io/fs"
+	"maps"
 	"math"
 	"math/big"
 	"os"
+	"path/filepath"
+	"slices"
 )
 
 func randInt() uint64 {
@@ -26,3 +31,44 @@ func MkdirTemp(dir, pattern string) (string, error) {
 	}
 	return d, nil
 }
+
+func HashString(s string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(s)))
+}
+
+// HashFiles returns a hash of the names and the contents of files, relative path to content.
+func HashFiles(files map[string][]byte) string {
+	h := sha256.New()
+	for _, x := range slices.Sorted(maps.Keys(files)) {
+		fmt.Fprintf(h, "%s\x00%d\x00", filepath.ToSlash(x), len(files[x]))
+		_, _ = h.Write(files[x])
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// HashDir returns a hash of the names and the contents of files in dir.
+func HashDir(dir string) (string, error) {
+	h := sha256.New()
+	if err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00", rel, len(b))
+		_, _ = h.Write(b)
+		return nil
+	}); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
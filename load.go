@@ -0,0 +1,211 @@
+package linep
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrTemplateCycle      = errors.New("TemplateCycle")
+	ErrInvalidTemplateSet = errors.New("InvalidTemplateSet")
+)
+
+// templateDoc is a template as a yaml document, used to merge templates field by field.
+type templateDoc map[string]any
+
+func newTemplateDoc(t *Template) (templateDoc, error) {
+	b, err := yaml.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+	var d templateDoc
+	if err := yaml.Unmarshal(b, &d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func parseTemplateDoc(b []byte) (templateDoc, error) {
+	var d templateDoc
+	if err := yaml.Unmarshal(b, &d); err != nil {
+		return nil, err
+	}
+	if d == nil {
+		d = templateDoc{}
+	}
+	return d, nil
+}
+
+func (d templateDoc) Template() (*Template, error) {
+	b, err := yaml.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+	var t Template
+	if err := yaml.Unmarshal(b, &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// Merge overwrites d by other.
+// Maps are merged recursively, other values are replaced.
+func (d templateDoc) Merge(other templateDoc) {
+	mergeMap(d, other)
+}
+
+func mergeMap(dst, src map[string]any) {
+	for k, v := range src {
+		s, ok := v.(map[string]any)
+		if !ok {
+			dst[k] = v
+			continue
+		}
+		t, ok := dst[k].(map[string]any)
+		if !ok {
+			t = map[string]any{}
+			dst[k] = t
+		}
+		mergeMap(t, s)
+	}
+}
+
+// Set sets a field of the template by field=value.
+// field is a yaml key of the template like exec, or key.name for a map field like macros.NAME.
+// value of a string field is used as it is, others are parsed as yaml.
+func (d templateDoc) Set(expr string) error {
+	key, value, ok := strings.Cut(expr, "=")
+	if !ok {
+		return fmt.Errorf("%w: should be field=value: %s", ErrInvalidTemplateSet, expr)
+	}
+	field, sub, isSub := strings.Cut(key, ".")
+	typ, ok := templateFieldTypes()[field]
+	if !ok {
+		return fmt.Errorf("%w: unknown field: %s", ErrInvalidTemplateSet, field)
+	}
+	if isSub {
+		if typ.Kind() != reflect.Map {
+			return fmt.Errorf("%w: not a map: %s", ErrInvalidTemplateSet, field)
+		}
+		typ = typ.Elem()
+	}
+
+	var v any = value
+	if typ.Kind() != reflect.String {
+		if err := yaml.Unmarshal([]byte(value), &v); err != nil {
+			return fmt.Errorf("%w: %w: %s", ErrInvalidTemplateSet, err, expr)
+		}
+	}
+
+	if !isSub {
+		d[field] = v
+		return nil
+	}
+	m, ok := d[field].(map[string]any)
+	if !ok {
+		m = map[string]any{}
+		d[field] = m
+	}
+	m[sub] = v
+	return nil
+}
+
+// templateFieldTypes returns yaml keys of Template and their types.
+func templateFieldTypes() map[string]reflect.Type {
+	var (
+		r = map[string]reflect.Type{}
+		t = reflect.TypeFor[Template]()
+	)
+	for i := range t.NumField() {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		r[name] = f.Type
+	}
+	return r
+}
+
+// templateLoader loads a template and the templates it extends.
+type templateLoader struct {
+	seen map[string]bool
+	// paths are directories of NAME.yml or NAME.yaml, the latter takes precedence.
+	paths []string
+}
+
+// loadTemplateDoc loads a builtin template, a template in paths or a template file named name, resolving extends.
+func loadTemplateDoc(name string, paths []string) (templateDoc, error) {
+	l := &templateLoader{
+		seen:  map[string]bool{},
+		paths: paths,
+	}
+	return l.load(name, "")
+}
+
+// find returns the template file named name in the paths.
+func (l *templateLoader) find(name string) (string, bool) {
+	if name == "" || strings.ContainsRune(name, filepath.Separator) || filepath.Ext(name) != "" {
+		return "", false
+	}
+	for _, dir := range slices.Backward(l.paths) {
+		for _, ext := range []string{".yml", ".yaml"} {
+			x := filepath.Join(dir, name+ext)
+			if info, err := os.Stat(x); err == nil && info.Mode().IsRegular() {
+				return x, true
+			}
+		}
+	}
+	return "", false
+}
+
+func (l *templateLoader) load(name, dir string) (templateDoc, error) {
+	if x, ok := builtinTemplates.get(name); ok {
+		return newTemplateDoc(x)
+	}
+	if x, ok := strings.CutPrefix(name, TemplateDataPrefix); ok {
+		b, err := decodeTemplate(x)
+		if err != nil {
+			return nil, err
+		}
+		return parseTemplateDoc(b)
+	}
+
+	path := name
+	if x, ok := l.find(name); ok {
+		path = x
+	} else if dir != "" && !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	if l.seen[path] {
+		return nil, fmt.Errorf("%w: %s", ErrTemplateCycle, path)
+	}
+	l.seen[path] = true
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	d, err := parseTemplateDoc(b)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, path)
+	}
+
+	parent, ok := d["extends"].(string)
+	if !ok || parent == "" {
+		return d, nil
+	}
+	r, err := l.load(parent, filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("%w: extends %s", err, parent)
+	}
+	r.Merge(d)
+	return r, nil
+}
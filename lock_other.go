@@ -0,0 +1,8 @@
+//go:build !unix
+
+package linep
+
+// lockFile does nothing since file locks are not supported.
+func lockFile(string) (func() error, error) {
+	return func() error { return nil }, nil
+}
@@ -0,0 +1,24 @@
+//go:build unix
+
+package linep
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile locks the file exclusively, creating it if not exists.
+func lockFile(name string) (func() error, error) {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return func() error {
+		defer f.Close()
+		return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+	}, nil
+}
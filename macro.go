@@ -0,0 +1,150 @@
+package linep
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrInvalidMacro = errors.New("InvalidMacro")
+)
+
+const (
+	MacroExecPWD  = "EXEC_PWD"
+	MacroMain     = "MAIN"
+	MacroSrcDir   = "SRC_DIR"
+	MacroWorkDir  = "WORK_DIR"
+	MacroCacheDir = "CACHE_DIR"
+	// MacroBinary is the executable built by export --binary.
+	MacroBinary = "BINARY"
+)
+
+var (
+	builtinMacros   = []string{MacroExecPWD, MacroMain, MacroSrcDir, MacroWorkDir, MacroCacheDir, MacroBinary}
+	macroNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// ReservedMacroEnv is patterns of the environment variables that are not available as macro names
+// since macros are exported as environment variables of steps,
+// in addition to [CleanEnvAllowlist].
+var ReservedMacroEnv = []string{
+	"PWD",
+	"OLDPWD",
+	"IFS",
+	"ENV",
+	"BASH_ENV",
+	"CDPATH",
+	"PS1",
+	"PS2",
+	"PS4",
+	"LD_*",
+	"DYLD_*",
+	"PYTHONPATH",
+	"PYTHONHOME",
+}
+
+func isReservedMacroEnv(name string) bool {
+	if isAllowedEnv(name) {
+		return true
+	}
+	for _, p := range ReservedMacroEnv {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateMacroName validates the name of a macro.
+// Builtin macros and environment variables like PATH, see [ReservedMacroEnv], are rejected.
+func ValidateMacroName(name string) error {
+	if !macroNameRegexp.MatchString(name) {
+		return fmt.Errorf("%w: invalid name: %q", ErrInvalidMacro, name)
+	}
+	for _, x := range builtinMacros {
+		if x == name {
+			return fmt.Errorf("%w: reserved name: %s", ErrInvalidMacro, name)
+		}
+	}
+	if isReservedMacroEnv(name) {
+		return fmt.Errorf("%w: reserved environment variable name: %s", ErrInvalidMacro, name)
+	}
+	return nil
+}
+
+// ParseMacros parses NAME=value pairs.
+func ParseMacros(v []string) (map[string]string, error) {
+	d := map[string]string{}
+	for _, x := range v {
+		name, value, ok := strings.Cut(x, "=")
+		if !ok {
+			return nil, fmt.Errorf("%w: should be NAME=value: %s", ErrInvalidMacro, x)
+		}
+		if err := ValidateMacroName(name); err != nil {
+			return nil, err
+		}
+		d[name] = value
+	}
+	return d, nil
+}
+
+func isMacroNameByte(c byte, head bool) bool {
+	switch {
+	case c == '_', 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z':
+		return true
+	case '0' <= c && c <= '9':
+		return !head
+	default:
+		return false
+	}
+}
+
+// ExpandMacros replaces @NAME with the reference of the environment variable NAME, "${NAME}",
+// if known reports true for NAME.
+// @@ is replaced with @.
+// Unknown macros are left as they are.
+func ExpandMacros(s string, known func(name string) bool) string {
+	return SubstituteMacros(s, func(name string) (string, bool) {
+		if !known(name) {
+			return "", false
+		}
+		return fmt.Sprintf(`"${%s}"`, name), true
+	})
+}
+
+// SubstituteMacros replaces @NAME with the value if value reports true for NAME.
+// @@ is replaced with @.
+// Unknown macros are left as they are.
+func SubstituteMacros(s string, value func(name string) (string, bool)) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c != '@' {
+			b.WriteByte(c)
+			i++
+			continue
+		}
+		if i+1 < len(s) && s[i+1] == '@' { // escape
+			b.WriteByte('@')
+			i += 2
+			continue
+		}
+		j := i + 1
+		for j < len(s) && isMacroNameByte(s[j], j == i+1) {
+			j++
+		}
+		x, ok := "", false
+		if name := s[i+1 : j]; name != "" {
+			x, ok = value(name)
+		}
+		if !ok {
+			x = s[i:j]
+		}
+		b.WriteString(x)
+		i = j
+	}
+	return b.String()
+}
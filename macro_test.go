@@ -0,0 +1,69 @@
+package linep_test
+
+import (
+	"testing"
+
+	"github.com/berquerant/linep"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandMacros(t *testing.T) {
+	known := func(name string) bool {
+		return name == "MAIN" || name == "SRC_DIR"
+	}
+	for _, tc := range []struct {
+		title string
+		input string
+		want  string
+	}{
+		{title: "empty", input: "", want: ""},
+		{title: "no macros", input: "go run main.go", want: "go run main.go"},
+		{title: "macro", input: "go run @MAIN", want: `go run "${MAIN}"`},
+		{title: "macros", input: "cd @SRC_DIR && go run @MAIN", want: `cd "${SRC_DIR}" && go run "${MAIN}"`},
+		{title: "escape", input: "echo @@MAIN", want: "echo @MAIN"},
+		{title: "escape at", input: "echo @@", want: "echo @"},
+		{title: "unknown", input: "go get x@latest @MAINX", want: "go get x@latest @MAINX"},
+		{title: "trailing at", input: "echo @", want: "echo @"},
+		{title: "followed by symbol", input: "@MAIN/x", want: `"${MAIN}"/x`},
+		{title: "digit head", input: "@1MAIN", want: "@1MAIN"},
+	} {
+		t.Run(tc.title, func(t *testing.T) {
+			assert.Equal(t, tc.want, linep.ExpandMacros(tc.input, known))
+		})
+	}
+}
+
+func TestSubstituteMacros(t *testing.T) {
+	value := func(name string) (string, bool) {
+		if name == "SRC_DIR" {
+			return "/tmp/src dir", true
+		}
+		return "", false
+	}
+	assert.Equal(t, "cd /tmp/src dir/x @MAIN @", linep.SubstituteMacros("cd @SRC_DIR/x @MAIN @@", value))
+}
+
+func TestParseMacros(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		got, err := linep.ParseMacros([]string{"A=1", "B_2=x=y", "C="})
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]string{"A": "1", "B_2": "x=y", "C": ""}, got)
+	})
+	for _, tc := range []struct {
+		title string
+		input string
+	}{
+		{title: "no value", input: "A"},
+		{title: "invalid name", input: "A-B=1"},
+		{title: "reserved", input: "MAIN=x"},
+		{title: "PATH", input: "PATH=x"},
+		{title: "LC_ALL", input: "LC_ALL=x"},
+		{title: "GOPATH", input: "GOPATH=x"},
+		{title: "LD_PRELOAD", input: "LD_PRELOAD=x"},
+	} {
+		t.Run(tc.title, func(t *testing.T) {
+			_, err := linep.ParseMacros([]string{tc.input})
+			assert.ErrorIs(t, err, linep.ErrInvalidMacro)
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package linep
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Plan describes what the executor would do.
+type Plan struct {
+	Template string   `json:"template" yaml:"template"`
+	Lang     string   `json:"lang,omitempty" yaml:"lang,omitempty"`
+	Shell    []string `json:"shell" yaml:"shell"`
+	WorkDir  string   `json:"workDir" yaml:"workDir"`
+	// SrcDir is the directory of the generated script, a new one is created for each run
+	// so it is an example.
+	SrcDir   string `json:"srcDir" yaml:"srcDir"`
+	CacheDir string `json:"cacheDir" yaml:"cacheDir"`
+	Main     string `json:"main" yaml:"main"`
+	// Files are the files generated in SrcDir.
+	Files  []string          `json:"files" yaml:"files"`
+	Import []string          `json:"import,omitempty" yaml:"import,omitempty"`
+	Deps   []string          `json:"deps,omitempty" yaml:"deps,omitempty"`
+	Args   []string          `json:"args,omitempty" yaml:"args,omitempty"`
+	Macros map[string]string `json:"macros" yaml:"macros"`
+	// CleanEnv passes only allowlisted environment variables of linep to steps.
+	CleanEnv bool `json:"cleanEnv" yaml:"cleanEnv"`
+	// Env is the keys of the environment variables of steps other than macros, changed from the environment of linep.
+	Env   []string   `json:"env,omitempty" yaml:"env,omitempty"`
+	Steps []PlanStep `json:"steps" yaml:"steps"`
+}
+
+// PlanStep describes a step to run.
+type PlanStep struct {
+	Name  string `json:"name" yaml:"name"`
+	Dir   string `json:"dir" yaml:"dir"`
+	Stdio string `json:"stdio,omitempty" yaml:"stdio,omitempty"`
+	When  string `json:"when,omitempty" yaml:"when,omitempty"`
+	Cache bool   `json:"cache,omitempty" yaml:"cache,omitempty"`
+	// Cached means the step will be skipped by the cache.
+	Cached bool `json:"cached,omitempty" yaml:"cached,omitempty"`
+	// Run is the script command, macros are replaced with their values.
+	Run string `json:"run" yaml:"run"`
+}
+
+// plan describes the steps without running them like Execute.
+// It does not write the source directory and the cache directory, just computes their paths.
+func (e *Executor) plan() (*Plan, error) {
+	if e.tmpDir == "" {
+		e.tmpDir = tempDirPattern(e.WorkDir, "linep")
+	}
+	files, err := e.renderSources()
+	if err != nil {
+		return nil, fmt.Errorf("%w: render template", err)
+	}
+	if err := e.initSourceMap(); err != nil {
+		return nil, fmt.Errorf("%w: source map", err)
+	}
+	e.cacheDir = e.cacheDirOf(files)
+	steps, scripts, err := e.renderSteps()
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Plan{
+		Template: e.Template.Name,
+		Lang:     e.Template.Lang,
+		Shell:    e.Shell,
+		WorkDir:  e.WorkDir,
+		SrcDir:   e.tmpDir,
+		CacheDir: e.cacheDir,
+		Main:     e.Template.Main,
+		Import:   e.Args.Import,
+		Deps:     e.deps(),
+		Args:     e.Args.Args,
+		Macros:   e.macros(),
+		CleanEnv: e.CleanEnv,
+		Env:      e.planEnv(),
+	}
+	p.Files = slices.Collect(maps.Keys(files))
+	if len(e.deps()) > 0 {
+		m, err := NewManifest(e.Template.Lang)
+		if err != nil {
+			return nil, err
+		}
+		p.Files = append(p.Files, m.Filename())
+	}
+	slices.Sort(p.Files)
+
+	if e.Check {
+		i := slices.IndexFunc(steps, func(s Step) bool { return s.Name == StepExec })
+		if i < 0 {
+			i = len(steps)
+		}
+		steps, scripts = steps[:i], scripts[:i]
+	}
+	for i, s := range steps {
+		x, err := e.renderStepWith(s, e.substituteMacros)
+		if err != nil {
+			return nil, err
+		}
+		p.Steps = append(p.Steps, PlanStep{
+			Name:   s.Name,
+			Dir:    e.stepDir(s),
+			Stdio:  s.Stdio,
+			When:   s.When,
+			Cache:  s.Cache,
+			Cached: s.Cache && e.isCached(s, scripts[i]),
+			Run:    x,
+		})
+	}
+	if e.Check {
+		if e.Template.Check == "" {
+			return nil, fmt.Errorf("%w: no check", ErrInvalidTemplate)
+		}
+		x, err := e.renderStepWith(Step{
+			Name: StepCheck,
+			Run:  e.Template.Check,
+		}, e.substituteMacros)
+		if err != nil {
+			return nil, err
+		}
+		p.Steps = append(p.Steps, PlanStep{
+			Name: StepCheck,
+			Dir:  e.tmpDir,
+			Run:  x,
+		})
+	}
+	return p, nil
+}
+
+// planEnv returns the keys of the environment of steps, added or changed from the environment of linep.
+// The values are not included since they can be secrets.
+func (e Executor) planEnv() []string {
+	var (
+		base   = map[string]bool{}
+		macros = e.macros()
+		r      []string
+	)
+	for _, x := range os.Environ() {
+		base[x] = true
+	}
+	for _, x := range e.newEnv().IntoSlice() {
+		if base[x] {
+			continue
+		}
+		k, _, _ := strings.Cut(x, "=")
+		if _, ok := macros[k]; ok {
+			continue
+		}
+		r = append(r, k)
+	}
+	slices.Sort(r)
+	return r
+}
+
+var shellSafe = regexp.MustCompile(`^[A-Za-z0-9_/.:%+=,-]+$`)
+
+// substituteMacros replaces macros in s with their values, quoted if needed.
+func (e Executor) substituteMacros(s string) string {
+	m := e.macros()
+	return SubstituteMacros(s, func(name string) (string, bool) {
+		x, ok := m[name]
+		if !ok {
+			return "", false
+		}
+		if shellSafe.MatchString(x) {
+			return x, true
+		}
+		return ShQuote(x), true
+	})
+}
+
+// listFiles returns the relative paths of the regular files in dir.
+func listFiles(dir string) ([]string, error) {
+	var r []string
+	if err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		r = append(r, rel)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (e *Executor) displayPlan(w io.Writer) error {
+	p, err := e.plan()
+	if err != nil {
+		return err
+	}
+	if e.JSON {
+		b, err := json.MarshalIndent(p, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", b)
+		return err
+	}
+	b, err := yaml.Marshal(p)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s", b)
+	return err
+}
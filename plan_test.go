@@ -0,0 +1,86 @@
+package linep_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/berquerant/linep"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlan(t *testing.T) {
+	pwd := t.TempDir()
+	newPlan := func(t *testing.T, check bool) *linep.Plan {
+		t.Helper()
+		c := &linep.Config{
+			TemplateName: "py",
+			Map:          "print(x)",
+			Args:         []string{"a b"},
+			Env:          []string{"GREETING=hello"},
+			Cwd:          "exec",
+			Check:        check,
+			PWD:          pwd,
+			Plan:         true,
+			JSON:         true,
+		}
+		var stdout bytes.Buffer
+		workDir := filepath.Join(t.TempDir(), "work")
+		c.WorkDir = workDir
+		e, err := c.Executor(nil, &stdout)
+		if !assert.Nil(t, err) {
+			return nil
+		}
+		defer e.Close()
+		if !assert.Nil(t, e.Execute(context.TODO())) {
+			return nil
+		}
+		_, err = os.Stat(workDir)
+		assert.ErrorIs(t, err, os.ErrNotExist, "plan should not write files")
+		var p linep.Plan
+		if !assert.Nil(t, json.Unmarshal(stdout.Bytes(), &p)) {
+			return nil
+		}
+		return &p
+	}
+
+	t.Run("exec", func(t *testing.T) {
+		p := newPlan(t, false)
+		if p == nil {
+			return
+		}
+		assert.Equal(t, []string{"main.py"}, p.Files)
+		assert.Equal(t, []string{"GREETING"}, p.Env)
+		assert.Equal(t, pwd, p.Macros[linep.MacroExecPWD])
+		if !assert.Equal(t, 2, len(p.Steps)) {
+			return
+		}
+		assert.Equal(t, linep.StepInit, p.Steps[0].Name)
+		assert.Equal(t, p.SrcDir, p.Steps[0].Dir)
+		x := p.Steps[1]
+		assert.Equal(t, linep.StepExec, x.Name)
+		assert.Equal(t, pwd, x.Dir)
+		assert.Equal(t,
+			"PYTHONPATH="+p.SrcDir+"/.deps${PYTHONPATH:+:$PYTHONPATH} python "+filepath.Join(p.SrcDir, "main.py")+" 'a b'",
+			x.Run,
+		)
+	})
+
+	t.Run("check", func(t *testing.T) {
+		p := newPlan(t, true)
+		if p == nil {
+			return
+		}
+		if !assert.Equal(t, 2, len(p.Steps)) {
+			return
+		}
+		assert.Equal(t, linep.StepInit, p.Steps[0].Name)
+		x := p.Steps[1]
+		assert.Equal(t, linep.StepCheck, x.Name)
+		assert.Equal(t, p.SrcDir, x.Dir)
+		assert.Equal(t, "python -m py_compile main.py", x.Run)
+	})
+}
@@ -0,0 +1,168 @@
+package linep
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrInvalidScriptFile = errors.New("InvalidScriptFile")
+)
+
+// ScriptFile is a script file of linep, executable by the shebang "#!/usr/bin/env -S linep script".
+//
+//	#!/usr/bin/env -S linep script
+//	---
+//	template: py
+//	import:
+//	  - math
+//	--- init
+//	acc = []
+//	--- map
+//	acc.append(int(x))
+//	--- reduce
+//	print(math.prod(acc))
+type ScriptFile struct {
+	// Template is TEMPLATE, default is selected by the file extension of the script file.
+	Template string `yaml:"template"`
+	// Values are flags like the config file.
+	Values map[string]any `yaml:",inline"`
+	Init   string         `yaml:"-"`
+	Map    string         `yaml:"-"`
+	Reduce string         `yaml:"-"`
+	// dir is the directory of the file, relative paths are resolved from it.
+	dir string
+}
+
+var scriptSectionPattern = regexp.MustCompile(`^---[ \t]+([A-Za-z]+)[ \t]*$`)
+
+// ReadScriptFile reads the script file.
+func ReadScriptFile(name string) (*ScriptFile, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	s, err := ParseScriptFile(b)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, name)
+	}
+	s.dir = filepath.Dir(name)
+	if s.Template == "" {
+		x, ok := TemplateNameFromFilename(name)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s: no template", ErrInvalidScriptFile, name)
+		}
+		s.Template = x
+	}
+	return s, nil
+}
+
+// ParseScriptFile parses the shebang, the frontmatter and the sections init, map and reduce.
+func ParseScriptFile(b []byte) (*ScriptFile, error) {
+	var (
+		s        ScriptFile
+		sections = map[string]*string{
+			"init":   &s.Init,
+			"map":    &s.Map,
+			"reduce": &s.Reduce,
+		}
+		frontmatter strings.Builder
+		current     *strings.Builder
+		contents    = map[string]*strings.Builder{}
+		scanner     = bufio.NewScanner(bytes.NewReader(b))
+		head        = true
+		n           int
+	)
+	scanner.Buffer(nil, 16*1024*1024)
+	for scanner.Scan() {
+		n++
+		line := scanner.Text()
+		if head {
+			if n == 1 && strings.HasPrefix(line, "#!") {
+				continue
+			}
+			if line != "---" {
+				return nil, fmt.Errorf("%w: line %d: require --- at the head", ErrInvalidScriptFile, n)
+			}
+			head = false
+			current = &frontmatter
+			continue
+		}
+		if m := scriptSectionPattern.FindStringSubmatch(line); m != nil {
+			name := m[1]
+			if _, ok := sections[name]; !ok {
+				return nil, fmt.Errorf("%w: line %d: unknown section: %s", ErrInvalidScriptFile, n, name)
+			}
+			if _, ok := contents[name]; ok {
+				return nil, fmt.Errorf("%w: line %d: duplicated section: %s", ErrInvalidScriptFile, n, name)
+			}
+			current = new(strings.Builder)
+			contents[name] = current
+			continue
+		}
+		current.WriteString(line)
+		current.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if head {
+		return nil, fmt.Errorf("%w: require --- at the head", ErrInvalidScriptFile)
+	}
+	if len(contents) == 0 {
+		return nil, fmt.Errorf("%w: no sections", ErrInvalidScriptFile)
+	}
+
+	if err := yaml.Unmarshal([]byte(frontmatter.String()), &s); err != nil {
+		return nil, fmt.Errorf("%w: frontmatter: %w", ErrInvalidScriptFile, err)
+	}
+	for k, v := range contents {
+		*sections[k] = v.String()
+	}
+	return &s, nil
+}
+
+// scriptFilePathKeys are the keys of the frontmatter of the paths resolved from the directory of the script file
+// in addition to template-path.
+var scriptFilePathKeys = []string{"input", "init-file", "map-file", "reduce-file", "env-file", "template-patch"}
+
+// isTemplatePath reports true if TEMPLATE is a path like ./go or go.yml, not a name like go.
+func isTemplatePath(template string) bool {
+	if _, ok := builtinTemplates.get(template); ok {
+		return false
+	}
+	return strings.ContainsRune(template, filepath.Separator) || filepath.Ext(template) != ""
+}
+
+// Args returns the command-line arguments TEMPLATE INIT MAP REDUCE [FLAGS] without the command name.
+// fs is to look up the flags.
+func (s ScriptFile) Args(fs *pflag.FlagSet) ([]string, error) {
+	values := maps.Clone(s.Values)
+	for _, k := range scriptFilePathKeys {
+		if v, ok := values[k]; ok {
+			values[k] = resolvePaths(v, s.dir)
+		}
+	}
+	flags, err := flagArgs(fs, values, s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("%w: frontmatter", err)
+	}
+	template := s.Template
+	if s.dir != "" && isTemplatePath(template) && !filepath.IsAbs(template) {
+		x := filepath.Join(s.dir, template)
+		if info, err := os.Stat(x); err == nil && info.Mode().IsRegular() {
+			template = x
+		}
+	}
+	return append([]string{template, codeArg(s.Init), codeArg(s.Map), codeArg(s.Reduce)}, flags...), nil
+}
@@ -0,0 +1,202 @@
+package linep_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/berquerant/linep"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseScriptFile(t *testing.T) {
+	for _, tc := range []struct {
+		title string
+		input string
+		want  *linep.ScriptFile
+		err   error
+	}{
+		{
+			title: "all",
+			input: `#!/usr/bin/env -S linep script
+---
+template: py
+quiet: true
+--- init
+acc = []
+--- map
+acc.append(x)
+--- reduce
+print(acc)
+`,
+			want: &linep.ScriptFile{
+				Template: "py",
+				Values:   map[string]any{"quiet": true},
+				Init:     "acc = []\n",
+				Map:      "acc.append(x)\n",
+				Reduce:   "print(acc)\n",
+			},
+		},
+		{
+			title: "map only",
+			input: `---
+--- map
+print(x)
+`,
+			want: &linep.ScriptFile{
+				Map: "print(x)\n",
+			},
+		},
+		{
+			title: "no head",
+			input: `--- map
+print(x)
+`,
+			err: linep.ErrInvalidScriptFile,
+		},
+		{
+			title: "no sections",
+			input: `---
+template: py
+`,
+			err: linep.ErrInvalidScriptFile,
+		},
+		{
+			title: "unknown section",
+			input: `---
+--- filter
+`,
+			err: linep.ErrInvalidScriptFile,
+		},
+		{
+			title: "duplicated section",
+			input: `---
+--- map
+--- map
+`,
+			err: linep.ErrInvalidScriptFile,
+		},
+	} {
+		t.Run(tc.title, func(t *testing.T) {
+			got, err := linep.ParseScriptFile([]byte(tc.input))
+			if tc.err != nil {
+				assert.ErrorIs(t, err, tc.err)
+				return
+			}
+			if !assert.Nil(t, err) {
+				return
+			}
+			assert.Equal(t, tc.want.Template, got.Template)
+			if len(tc.want.Values) > 0 {
+				assert.Equal(t, tc.want.Values, got.Values)
+			}
+			assert.Equal(t, tc.want.Init, got.Init)
+			assert.Equal(t, tc.want.Map, got.Map)
+			assert.Equal(t, tc.want.Reduce, got.Reduce)
+		})
+	}
+}
+
+func TestScriptFileArgs(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "upper.go")
+	if !assert.Nil(t, os.WriteFile(name, []byte(`---
+import:
+  - strings
+  - os
+--- map
+@@x
+`), 0755)) {
+		return
+	}
+	s, err := linep.ReadScriptFile(name)
+	if !assert.Nil(t, err) {
+		return
+	}
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	fs.String("import", "", "")
+	got, err := s.Args(fs)
+	if assert.Nil(t, err) {
+		assert.Equal(t, []string{"go", "", "@@@x\n", "", "--import=strings|os"}, got)
+	}
+}
+
+func TestScriptFileArgsTemplate(t *testing.T) {
+	dir := t.TempDir()
+	for _, x := range []string{"go", "tool.yml"} {
+		if !assert.Nil(t, os.WriteFile(filepath.Join(dir, x), nil, 0755)) {
+			return
+		}
+	}
+	for _, tc := range []struct {
+		template string
+		want     string
+	}{
+		{template: "go", want: "go"},
+		{template: "tool.yml", want: filepath.Join(dir, "tool.yml")},
+		{template: "mytemplate", want: "mytemplate"},
+		{template: "other.yml", want: "other.yml"},
+	} {
+		t.Run(tc.template, func(t *testing.T) {
+			name := filepath.Join(dir, "script")
+			if !assert.Nil(t, os.WriteFile(name, []byte("---\ntemplate: "+tc.template+"\n--- map\nx\n"), 0755)) {
+				return
+			}
+			s, err := linep.ReadScriptFile(name)
+			if !assert.Nil(t, err) {
+				return
+			}
+			got, err := s.Args(pflag.NewFlagSet("test", pflag.ContinueOnError))
+			if assert.Nil(t, err) {
+				assert.Equal(t, tc.want, got[0])
+			}
+		})
+	}
+}
+
+func TestScriptFileArgsPaths(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "script.py")
+	if !assert.Nil(t, os.WriteFile(name, []byte(`---
+input: data.txt
+init-file: init.py
+map-file: map.py
+reduce-file: /abs/reduce.py
+env-file:
+  - .env
+  - ../shared.env
+template-patch:
+  - patch.yml
+template-path:
+  - templates
+--- map
+print(x)
+`), 0755)) {
+		return
+	}
+	s, err := linep.ReadScriptFile(name)
+	if !assert.Nil(t, err) {
+		return
+	}
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	for _, x := range []string{"input", "init-file", "map-file", "reduce-file"} {
+		fs.String(x, "", "")
+	}
+	for _, x := range []string{"env-file", "template-patch", "template-path"} {
+		fs.StringArray(x, nil, "")
+	}
+	got, err := s.Args(fs)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, []string{
+		"--env-file=" + filepath.Join(dir, ".env"),
+		"--env-file=" + filepath.Join(filepath.Dir(dir), "shared.env"),
+		"--init-file=" + filepath.Join(dir, "init.py"),
+		"--input=" + filepath.Join(dir, "data.txt"),
+		"--map-file=" + filepath.Join(dir, "map.py"),
+		"--reduce-file=/abs/reduce.py",
+		"--template-patch=" + filepath.Join(dir, "patch.yml"),
+		"--template-path=" + filepath.Join(dir, "templates"),
+	}, got[4:])
+}
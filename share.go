@@ -0,0 +1,154 @@
+package linep
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TemplateDataPrefix is the prefix of TEMPLATE of the template encoded by [EncodeTemplate].
+const TemplateDataPrefix = "data:"
+
+// TemplateDataLimit is the max bytes of the template decoded from TEMPLATE of [TemplateDataPrefix].
+const TemplateDataLimit = 1 << 20
+
+// EncodeTemplate encodes the template into TEMPLATE argument, gzipped yaml in URL-safe base64.
+func EncodeTemplate(t *Template) (string, error) {
+	x := *t
+	// extends are resolved already
+	x.Extends = ""
+	b, err := yaml.Marshal(&x)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err := w.Write(b); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return TemplateDataPrefix + base64.RawURLEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// decodeTemplate returns the yaml of the template encoded by [EncodeTemplate] without [TemplateDataPrefix].
+func decodeTemplate(s string) ([]byte, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: decode: %w", ErrInvalidTemplate, err)
+	}
+	r, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("%w: decode: %w", ErrInvalidTemplate, err)
+	}
+	defer r.Close()
+	// not to be a decompression bomb
+	x, err := io.ReadAll(io.LimitReader(r, TemplateDataLimit+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: decode: %w", ErrInvalidTemplate, err)
+	}
+	if len(x) > TemplateDataLimit {
+		return nil, fmt.Errorf("%w: decode: exceeds %d bytes", ErrInvalidTemplate, TemplateDataLimit)
+	}
+	return x, nil
+}
+
+// isBuiltinTemplate reports true if t is the builtin template of TEMPLATE without changes.
+func (c Config) isBuiltinTemplate(t *Template) bool {
+	x, ok := builtinTemplates.get(c.TemplateName)
+	if !ok {
+		return false
+	}
+	a, err := yaml.Marshal(x)
+	if err != nil {
+		return false
+	}
+	b, err := yaml.Marshal(t)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(a, b)
+}
+
+// ShareCommand returns the shell command to run like c on another machine without files.
+// The template is encoded into TEMPLATE unless it is a builtin template without changes,
+// and the code of files is inlined.
+// --input and --env-file are not shared, and only the keys of --env are shared.
+func (c Config) ShareCommand() (string, error) {
+	t, err := c.Template()
+	if err != nil {
+		return "", err
+	}
+	template := c.TemplateName
+	if !c.isBuiltinTemplate(t) {
+		if template, err = EncodeTemplate(t); err != nil {
+			return "", fmt.Errorf("%w: encode template", err)
+		}
+	}
+
+	args := []string{template}
+	switch {
+	case c.Reduce != "":
+		args = append(args, codeArg(c.Init), codeArg(c.Map), codeArg(c.Reduce))
+	case c.Init != "":
+		args = append(args, codeArg(c.Init), codeArg(c.Map))
+	default:
+		args = append(args, codeArg(c.Map))
+	}
+	for _, x := range []struct {
+		name   string
+		values []string
+	}{
+		{name: "import", values: c.Import},
+		{name: "dep", values: c.Dep},
+		{name: "macro", values: c.Macro},
+		{name: "sh", values: c.Shell},
+	} {
+		if len(x.values) > 0 {
+			args = append(args, "--"+x.name, strings.Join(x.values, listSeparators[x.name]))
+		}
+	}
+	// values like secrets are passed from the environment
+	for _, x := range RedactEnv(c.Env) {
+		args = append(args, "--env", x)
+	}
+	if c.Cwd != "" {
+		args = append(args, "--cwd", c.Cwd)
+	}
+	for _, x := range []struct {
+		name  string
+		value bool
+	}{
+		{name: "clean-env", value: c.CleanEnv},
+		{name: "check", value: c.Check},
+		{name: "quiet", value: c.Quiet},
+	} {
+		if x.value {
+			args = append(args, "--"+x.name)
+		}
+	}
+	if len(c.Args) > 0 {
+		args = append(append(args, "--"), c.Args...)
+	}
+
+	if c.Input != "" {
+		slog.Warn("share: --input is not shared")
+	}
+	if len(c.Env) > 0 {
+		slog.Warn("share: values of --env are not shared")
+	}
+	if len(c.EnvFile) > 0 {
+		slog.Warn("share: --env-file is not shared")
+	}
+	return shellCommandLine(args), nil
+}
@@ -0,0 +1,114 @@
+package linep_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/berquerant/linep"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShareCommand(t *testing.T) {
+	for _, tc := range []struct {
+		title  string
+		config linep.Config
+		want   string
+	}{
+		{
+			title: "builtin",
+			config: linep.Config{
+				TemplateName: "go",
+				Map:          "fmt.Println(x)",
+				Import:       []string{"strings", "os"},
+				Quiet:        true,
+				Args:         []string{"a b"},
+			},
+			want: "linep go 'fmt.Println(x)' --import 'strings|os' --quiet -- 'a b'",
+		},
+		{
+			title: "init and map",
+			config: linep.Config{
+				TemplateName: "python",
+				Init:         "@dataclass",
+				Map:          "print(x)",
+				Env:          []string{"TOKEN=secret", "HOME"},
+			},
+			want: "linep python '@@dataclass' 'print(x)' --env TOKEN --env HOME",
+		},
+	} {
+		t.Run(tc.title, func(t *testing.T) {
+			got, err := tc.config.ShareCommand()
+			if assert.Nil(t, err) {
+				assert.Equal(t, tc.want, got)
+			}
+		})
+	}
+
+	t.Run("encoded", func(t *testing.T) {
+		c := linep.Config{
+			TemplateName: "py",
+			TemplateSet:  []string{"env.GREETING=hello"},
+			Map:          "print(x)",
+		}
+		got, err := c.ShareCommand()
+		if !assert.Nil(t, err) {
+			return
+		}
+		xs := strings.Fields(got)
+		if !assert.Equal(t, 3, len(xs)) || !assert.True(t, strings.HasPrefix(xs[1], linep.TemplateDataPrefix)) {
+			return
+		}
+
+		// decode
+		d := linep.Config{
+			TemplateName: xs[1],
+		}
+		x, err := d.Template()
+		if assert.Nil(t, err) {
+			assert.Equal(t, "python", x.Name)
+			assert.Equal(t, "hello", x.Env["GREETING"])
+		}
+	})
+}
+
+func TestEncodeTemplate(t *testing.T) {
+	x, err := linep.EncodeTemplate(&linep.Template{
+		Name:    "sample",
+		Main:    "main.sh",
+		Script:  "echo $x",
+		Extends: "sample.yml",
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.True(t, strings.HasPrefix(x, linep.TemplateDataPrefix))
+	assert.False(t, strings.ContainsAny(x, "' \""))
+
+	got, err := linep.Config{TemplateName: x}.Template()
+	if assert.Nil(t, err) {
+		assert.Equal(t, "sample", got.Name)
+		assert.Equal(t, "echo $x", got.Script)
+		assert.Equal(t, "", got.Extends)
+	}
+
+	_, err = linep.Config{TemplateName: linep.TemplateDataPrefix + "x"}.Template()
+	assert.ErrorIs(t, err, linep.ErrInvalidTemplate)
+}
+
+func TestDecodeTemplateLimit(t *testing.T) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(bytes.Repeat([]byte("#"), linep.TemplateDataLimit+1)); !assert.Nil(t, err) {
+		return
+	}
+	if !assert.Nil(t, w.Close()) {
+		return
+	}
+	_, err := linep.Config{
+		TemplateName: linep.TemplateDataPrefix + base64.RawURLEncoding.EncodeToString(buf.Bytes()),
+	}.Template()
+	assert.ErrorIs(t, err, linep.ErrInvalidTemplate)
+}
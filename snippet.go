@@ -0,0 +1,142 @@
+package linep
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrInvalidSnippet = errors.New("InvalidSnippet")
+)
+
+// Snippet is a saved invocation of linep.
+type Snippet struct {
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	// Args are the arguments of linep like TEMPLATE INIT MAP REDUCE [FLAGS] [-- ARGS...].
+	// They can contain placeholders @{key} or @{key:default}.
+	Args []string `json:"args" yaml:"args"`
+}
+
+// Snippets are snippets by name.
+type Snippets map[string]Snippet
+
+// DefaultSnippetsFile returns snippets.yaml in the directory of the default config file.
+func DefaultSnippetsFile() (string, error) {
+	x, err := DefaultConfigFile()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(x), "snippets.yaml"), nil
+}
+
+// ReadSnippetsFile reads the snippets file, it returns empty snippets if the file does not exist.
+func ReadSnippetsFile(name string) (Snippets, error) {
+	b, err := os.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return Snippets{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var s Snippets
+	if err := yaml.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSnippet, err)
+	}
+	if s == nil {
+		s = Snippets{}
+	}
+	return s, nil
+}
+
+func WriteSnippetsFile(name string, s Snippets) error {
+	b, err := yaml.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(name, b, 0644)
+}
+
+var snippetNamePattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*$`)
+
+func ValidateSnippetName(name string) error {
+	if !snippetNamePattern.MatchString(name) {
+		return fmt.Errorf("%w: invalid name: %q", ErrInvalidSnippet, name)
+	}
+	return nil
+}
+
+// placeholderPattern matches @{key} and @{key:default}.
+var placeholderPattern = regexp.MustCompile(`@\{([A-Za-z_][A-Za-z0-9_]*)(?::([^}]*))?\}`)
+
+// Placeholders returns the keys of the placeholders in the arguments.
+func (s Snippet) Placeholders() []string {
+	var r []string
+	for _, x := range s.Args {
+		for _, m := range placeholderPattern.FindAllStringSubmatch(x, -1) {
+			r = append(r, m[1])
+		}
+	}
+	slices.Sort(r)
+	return slices.Compact(r)
+}
+
+// Fill returns the arguments with the placeholders replaced with values.
+// A placeholder without the value is replaced with the default, or an error if it has no default.
+func (s Snippet) Fill(values map[string]string) ([]string, error) {
+	for k := range values {
+		if !slices.Contains(s.Placeholders(), k) {
+			return nil, fmt.Errorf("%w: unknown key: %s", ErrInvalidSnippet, k)
+		}
+	}
+	var (
+		r       = make([]string, len(s.Args))
+		missing []string
+	)
+	for i, x := range s.Args {
+		r[i] = placeholderPattern.ReplaceAllStringFunc(x, func(p string) string {
+			m := placeholderPattern.FindStringSubmatch(p)
+			if v, ok := values[m[1]]; ok {
+				return v
+			}
+			if strings.Contains(p, ":") {
+				return m[2]
+			}
+			missing = append(missing, m[1])
+			return p
+		})
+	}
+	if len(missing) > 0 {
+		slices.Sort(missing)
+		return nil, fmt.Errorf("%w: require values: %s", ErrInvalidSnippet, strings.Join(slices.Compact(missing), ", "))
+	}
+	return r, nil
+}
+
+// ParseSnippetValues parses key=value of the placeholders.
+func ParseSnippetValues(xs []string) (map[string]string, error) {
+	r := map[string]string{}
+	for _, x := range xs {
+		k, v, ok := strings.Cut(x, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("%w: should be key=value: %q", ErrInvalidSnippet, x)
+		}
+		r[k] = v
+	}
+	return r, nil
+}
+
+// Merge adds snippets of other, other takes precedence.
+func (s Snippets) Merge(other Snippets) {
+	maps.Copy(s, other)
+}
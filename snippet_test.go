@@ -0,0 +1,96 @@
+package linep_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/berquerant/linep"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnippet(t *testing.T) {
+	s := linep.Snippet{
+		Args: []string{"go", "fmt.Println(@{x}, @{y:1})", "--import", "@{pkg:strings}"},
+	}
+	t.Run("placeholders", func(t *testing.T) {
+		assert.Equal(t, []string{"pkg", "x", "y"}, s.Placeholders())
+	})
+
+	for _, tc := range []struct {
+		title  string
+		values map[string]string
+		want   []string
+		err    error
+	}{
+		{
+			title:  "defaults",
+			values: map[string]string{"x": "a"},
+			want:   []string{"go", "fmt.Println(a, 1)", "--import", "strings"},
+		},
+		{
+			title:  "override defaults",
+			values: map[string]string{"x": "a", "y": "", "pkg": "os"},
+			want:   []string{"go", "fmt.Println(a, )", "--import", "os"},
+		},
+		{
+			title: "missing",
+			err:   linep.ErrInvalidSnippet,
+		},
+		{
+			title:  "unknown key",
+			values: map[string]string{"x": "a", "z": "b"},
+			err:    linep.ErrInvalidSnippet,
+		},
+	} {
+		t.Run(tc.title, func(t *testing.T) {
+			got, err := s.Fill(tc.values)
+			if tc.err != nil {
+				assert.ErrorIs(t, err, tc.err)
+				return
+			}
+			if !assert.Nil(t, err) {
+				return
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestParseSnippetValues(t *testing.T) {
+	got, err := linep.ParseSnippetValues([]string{"a=1", "b=", "c=x=y"})
+	if assert.Nil(t, err) {
+		assert.Equal(t, map[string]string{"a": "1", "b": "", "c": "x=y"}, got)
+	}
+	_, err = linep.ParseSnippetValues([]string{"a"})
+	assert.ErrorIs(t, err, linep.ErrInvalidSnippet)
+}
+
+func TestSnippetsFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "linep", "snippets.yaml")
+	s, err := linep.ReadSnippetsFile(name)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, linep.Snippets{}, s)
+
+	s["upper"] = linep.Snippet{
+		Description: "convert case",
+		Args:        []string{"go", "fmt.Println(strings.ToUpper(x))"},
+	}
+	if !assert.Nil(t, linep.WriteSnippetsFile(name, s)) {
+		return
+	}
+	got, err := linep.ReadSnippetsFile(name)
+	if assert.Nil(t, err) {
+		assert.Equal(t, s, got)
+	}
+}
+
+func TestValidateSnippetName(t *testing.T) {
+	for _, x := range []string{"a", "a-b.c_1", "_x"} {
+		assert.Nil(t, linep.ValidateSnippetName(x), x)
+	}
+	for _, x := range []string{"", "-a", "a b", "a/b"} {
+		assert.ErrorIs(t, linep.ValidateSnippetName(x), linep.ErrInvalidSnippet, x)
+	}
+}
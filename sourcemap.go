@@ -0,0 +1,234 @@
+package linep
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	SectionInit   = "INIT"
+	SectionMap    = "MAP"
+	SectionReduce = "REDUCE"
+)
+
+// SourceLine is a line of INIT, MAP or REDUCE in the generated script.
+type SourceLine struct {
+	Section string
+	// Line is the 1-based line number in the section.
+	Line int
+	// Offset is the byte offset of the section line in the generated line.
+	Offset int
+	Text   string
+}
+
+// SourceMap maps lines of the generated script to lines of INIT, MAP and REDUCE.
+type SourceMap struct {
+	// Filename is the script file.
+	// If it is not empty, columns are mapped by the file, it may be formatted by the init step.
+	Filename string
+	// Lines are the section lines by the 1-based line number of the generated script.
+	Lines     map[int]SourceLine
+	generated []string
+	pattern   *regexp.Regexp
+
+	once   sync.Once
+	actual []string
+	// align is the line number of the generated script by the line number of the script file.
+	align map[int]int
+}
+
+// sourceMarker is put at the head of each line of the sections while mapping.
+// Private use characters are not changed by sprig functions like upper and reindent.
+var sourceMarker = regexp.MustCompile(`\x{E000}(\d+):(\d+)\x{E001}`)
+
+var sourceSections = []string{SectionInit, SectionMap, SectionReduce}
+
+func markSource(section int, s string) string {
+	lines := strings.Split(s, "\n")
+	for i, x := range lines {
+		if strings.TrimSpace(x) != "" {
+			lines[i] = fmt.Sprintf("\uE000%d:%d\uE001%s", section, i+1, x)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// SourceMap renders the script with markers at the head of each line of INIT, MAP and REDUCE
+// to know where they are in the generated script.
+// It returns nil if the markers change the script, e.g. MAP is quoted by the template.
+func (t Template) SourceMap(args *ScriptArgs) (*SourceMap, error) {
+	var want bytes.Buffer
+	if err := t.Execute(&want, args); err != nil {
+		return nil, err
+	}
+
+	x := t.normalize(args)
+	if x == nil {
+		x = &ScriptArgs{}
+	}
+	snippets := []string{x.Init, x.Map, x.Reduce}
+	x.Init = markSource(0, x.Init)
+	x.Map = markSource(1, x.Map)
+	x.Reduce = markSource(2, x.Reduce)
+	var b bytes.Buffer
+	if err := t.render(&b, t.Name, t.Script, x); err != nil {
+		return nil, err
+	}
+
+	var (
+		lines = strings.Split(b.String(), "\n")
+		m     = map[int]SourceLine{}
+	)
+	for i, line := range lines {
+		if loc := sourceMarker.FindStringSubmatchIndex(line); loc != nil {
+			section, _ := strconv.Atoi(line[loc[2]:loc[3]])
+			n, _ := strconv.Atoi(line[loc[4]:loc[5]])
+			m[i+1] = SourceLine{
+				Section: sourceSections[section],
+				Line:    n,
+				Offset:  loc[0],
+				Text:    strings.Split(snippets[section], "\n")[n-1],
+			}
+		}
+		lines[i] = sourceMarker.ReplaceAllString(line, "")
+	}
+	if strings.Join(lines, "\n") != want.String() {
+		return nil, nil
+	}
+
+	name := regexp.QuoteMeta(filepath.Base(t.Main))
+	return &SourceMap{
+		Lines:     m,
+		generated: lines,
+		// File "/path/main.py", line 12 of python or /path/main.go:12:5 of go and rust
+		pattern: regexp.MustCompile(`File "(?:[^"]*/)?` + name + `", line (\d+)|(?:[^\s:"]*/)?\b` + name + `:(\d+)(?::(\d+))?`),
+	}, nil
+}
+
+// lines returns the lines of the script file and their line numbers of the generated script.
+func (m *SourceMap) lines() ([]string, map[int]int) {
+	m.once.Do(func() {
+		m.actual = m.generated
+		if m.Filename != "" {
+			if b, err := os.ReadFile(m.Filename); err == nil {
+				m.actual = strings.Split(string(b), "\n")
+			}
+		}
+		m.align = alignLines(m.generated, m.actual)
+	})
+	return m.actual, m.align
+}
+
+// alignWindow is the number of generated lines to look ahead for a line of the script file.
+const alignWindow = 8
+
+// alignLines finds the line of generated for each line of actual, changed by a formatter like gofmt.
+// Lines are compared without whitespaces, blank lines and lines not found are not aligned.
+func alignLines(generated, actual []string) map[int]int {
+	var (
+		r   = map[int]int{}
+		key = func(s string) string {
+			return strings.Join(strings.Fields(s), "")
+		}
+		j int
+	)
+	for i, x := range actual {
+		k := key(x)
+		if k == "" {
+			continue
+		}
+		for d := range min(alignWindow, len(generated)-j) {
+			if key(generated[j+d]) == k {
+				r[i+1] = j + d + 1
+				j += d + 1
+				break
+			}
+		}
+	}
+	return r
+}
+
+// column returns the 1-based column in the section line of the 1-based column of the line of the script file.
+// It returns 0 if unknown.
+func (m *SourceMap) column(line string, g, col int, s SourceLine) int {
+	if col < 1 {
+		return 0
+	}
+	var (
+		c     int
+		body  = strings.TrimLeft(line, " \t")
+		sBody = strings.TrimLeft(s.Text, " \t")
+	)
+	switch {
+	case line == m.generated[g-1]:
+		c = col - s.Offset
+	case body == sBody:
+		// reindented by a formatter
+		c = col - (len(line) - len(body)) + (len(s.Text) - len(sBody))
+	}
+	if c < 1 || c > len(s.Text)+1 {
+		return 0
+	}
+	return c
+}
+
+// Rewrite replaces the location of the script in a line of compiler or runtime errors
+// with the location of INIT, MAP or REDUCE, and appends the section line with a caret.
+func (m *SourceMap) Rewrite(line string) []string {
+	loc := m.pattern.FindStringSubmatchIndex(line)
+	if loc == nil {
+		return []string{line}
+	}
+	group := func(i int) int {
+		if loc[2*i] < 0 {
+			return 0
+		}
+		x, _ := strconv.Atoi(line[loc[2*i]:loc[2*i+1]])
+		return x
+	}
+	n := group(1)
+	if n == 0 {
+		n = group(2)
+	}
+	lines, align := m.lines()
+	g, ok := align[n]
+	if !ok {
+		return []string{line}
+	}
+	s, ok := m.Lines[g]
+	if !ok {
+		return []string{line}
+	}
+
+	var (
+		col = m.column(lines[n-1], g, group(3), s)
+		pos = fmt.Sprintf("%s line %d", s.Section, s.Line)
+	)
+	if col > 0 {
+		pos += fmt.Sprintf(", col %d", col)
+	}
+	var (
+		num    = strconv.Itoa(s.Line)
+		result = []string{
+			line[:loc[0]] + pos + line[loc[1]:],
+			fmt.Sprintf("  %s | %s", num, s.Text),
+		}
+	)
+	if col > 0 {
+		// keep tabs to put the caret under the column
+		pad := strings.Map(func(r rune) rune {
+			if r == '\t' {
+				return r
+			}
+			return ' '
+		}, s.Text[:col-1])
+		result = append(result, fmt.Sprintf("  %s | %s^", strings.Repeat(" ", len(num)), pad))
+	}
+	return result
+}
@@ -0,0 +1,145 @@
+package linep_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/berquerant/linep"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSourceMap(t *testing.T) {
+	const script = `package main
+func main() {
+  {{- .Init | reindent 2}}
+  for {
+    {{- .Map | reindent 4}}
+  }
+}
+`
+	args := &linep.ScriptArgs{
+		Init: "x := 1",
+		Map:  "\n    y := x\n    fmt.Println(z)\n",
+	}
+	newSourceMap := func(t *testing.T, main, script string) *linep.SourceMap {
+		t.Helper()
+		m, err := linep.Template{
+			Name:   "test",
+			Script: script,
+			Main:   main,
+		}.SourceMap(args)
+		if !assert.Nil(t, err) {
+			return nil
+		}
+		return m
+	}
+
+	t.Run("lines", func(t *testing.T) {
+		m := newSourceMap(t, "main.go", script)
+		assert.Equal(t, map[int]linep.SourceLine{
+			3: {Section: linep.SectionInit, Line: 1, Offset: 2, Text: "x := 1"},
+			5: {Section: linep.SectionMap, Line: 1, Offset: 4, Text: "y := x"},
+			6: {Section: linep.SectionMap, Line: 2, Offset: 4, Text: "fmt.Println(z)"},
+		}, m.Lines)
+	})
+
+	t.Run("quoted", func(t *testing.T) {
+		assert.Nil(t, newSourceMap(t, "main.go", `{{ goQuote .Map }}`))
+	})
+
+	for _, tc := range []struct {
+		title string
+		main  string
+		line  string
+		want  []string
+	}{
+		{
+			title: "go",
+			main:  "main.go",
+			line:  "./main.go:6:17: undefined: z",
+			want: []string{
+				"MAP line 2, col 13: undefined: z",
+				"  2 | fmt.Println(z)",
+				"    |             ^",
+			},
+		},
+		{
+			title: "go panic",
+			main:  "main.go",
+			line:  "\t/tmp/linep123/main.go:3 +0x1d",
+			want: []string{
+				"\tINIT line 1 +0x1d",
+				"  1 | x := 1",
+			},
+		},
+		{
+			title: "rust",
+			main:  "main.rs",
+			line:  "  --> main.rs:5:5",
+			want: []string{
+				"  --> MAP line 1, col 1",
+				"  1 | y := x",
+				"    | ^",
+			},
+		},
+		{
+			title: "python",
+			main:  "main.py",
+			line:  `  File "/tmp/linep123/main.py", line 6, in <module>`,
+			want: []string{
+				"  MAP line 2, in <module>",
+				"  2 | fmt.Println(z)",
+			},
+		},
+		{
+			title: "not in sections",
+			main:  "main.go",
+			line:  "./main.go:2:1: error",
+			want:  []string{"./main.go:2:1: error"},
+		},
+		{
+			title: "other file",
+			main:  "main.go",
+			line:  "./xmain.go:6:17: error",
+			want:  []string{"./xmain.go:6:17: error"},
+		},
+	} {
+		t.Run(tc.title, func(t *testing.T) {
+			m := newSourceMap(t, tc.main, script)
+			assert.Equal(t, tc.want, m.Rewrite(tc.line))
+		})
+	}
+
+	t.Run("formatted", func(t *testing.T) {
+		m := newSourceMap(t, "main.go", script)
+		m.Filename = filepath.Join(t.TempDir(), "main.go")
+		formatted := "package main\nfunc main() {\n\tx := 1\n\tfor {\n\t\ty := x\n\t\tfmt.Println(z)\n\t}\n}\n"
+		if !assert.Nil(t, os.WriteFile(m.Filename, []byte(formatted), 0644)) {
+			return
+		}
+		assert.Equal(t, []string{
+			"MAP line 2, col 13: undefined: z",
+			"  2 | fmt.Println(z)",
+			"    |             ^",
+		}, m.Rewrite("./main.go:6:15: undefined: z"))
+	})
+
+	t.Run("lines changed", func(t *testing.T) {
+		m := newSourceMap(t, "main.go", script)
+		m.Filename = filepath.Join(t.TempDir(), "main.go")
+		formatted := "package main\n\nfunc main() {\n\tx := 1\n\tfor {\n\t\ty := x\n\n\t\tfmt.Println( z )\n\t}\n}\n"
+		if !assert.Nil(t, os.WriteFile(m.Filename, []byte(formatted), 0644)) {
+			return
+		}
+		assert.Equal(t, []string{
+			"MAP line 2: undefined: z",
+			"  2 | fmt.Println(z)",
+		}, m.Rewrite("./main.go:8:16: undefined: z"))
+		assert.Equal(t, []string{
+			"MAP line 1, col 6: undefined: x",
+			"  1 | y := x",
+			"    |      ^",
+		}, m.Rewrite("./main.go:6:8: undefined: x"))
+	})
+}
@@ -0,0 +1,129 @@
+package linep
+
+import (
+	"fmt"
+)
+
+const (
+	StepInit  = "init"
+	StepExec  = "exec"
+	StepCheck = "check"
+	StepFmt   = "fmt"
+	// StepBinary builds the executable by export --binary.
+	StepBinary = "binary"
+)
+
+const (
+	// CwdSrc runs the exec step in the directory of the script.
+	CwdSrc = "src"
+	// CwdExec runs the exec step in the current directory of linep execution.
+	CwdExec = "exec"
+)
+
+const (
+	// StdioAttach attaches stdin, stdout and stderr to the step.
+	StdioAttach = "attach"
+	// StdioStderr redirects stdout of the step to stderr, stdin is not attached.
+	StdioStderr = "stderr"
+	// StdioQuiet hides outputs of the step unless it fails.
+	StdioQuiet = "quiet"
+)
+
+const (
+	// WhenSuccess runs the step if all previous steps succeeded.
+	WhenSuccess = "success"
+	// WhenFailure runs the step if some previous step failed.
+	WhenFailure = "failure"
+	// WhenAlways runs the step regardless of previous steps.
+	WhenAlways = "always"
+)
+
+// Step is a command of the template lifecycle.
+type Step struct {
+	Name string `json:"name" yaml:"name"`
+	// Run is a script command, rendered by text/template and macros are available.
+	// Empty run of init and exec step is the init and exec of the template.
+	Run string `json:"run,omitempty" yaml:"run,omitempty"`
+	// Stdio is attach, stderr or quiet, default is stderr.
+	// Default of exec step is attach.
+	Stdio string `json:"stdio,omitempty" yaml:"stdio,omitempty"`
+	// When is success, failure or always, default is success.
+	When string `json:"when,omitempty" yaml:"when,omitempty"`
+	// Cache skips the step if it has succeeded with the same sources and run.
+	Cache bool `json:"cache,omitempty" yaml:"cache,omitempty"`
+}
+
+func ValidateCwd(cwd string) error {
+	switch cwd {
+	case "", CwdSrc, CwdExec:
+		return nil
+	default:
+		return fmt.Errorf("%w: invalid cwd: %s", ErrInvalidTemplate, cwd)
+	}
+}
+
+func (s Step) Validate() error {
+	if s.Name == "" {
+		return fmt.Errorf("%w: step: no name", ErrInvalidTemplate)
+	}
+	switch s.Stdio {
+	case StdioAttach, StdioStderr, StdioQuiet:
+	default:
+		return fmt.Errorf("%w: step %s: invalid stdio: %s", ErrInvalidTemplate, s.Name, s.Stdio)
+	}
+	switch s.When {
+	case WhenSuccess, WhenFailure, WhenAlways:
+	default:
+		return fmt.Errorf("%w: step %s: invalid when: %s", ErrInvalidTemplate, s.Name, s.When)
+	}
+	return nil
+}
+
+// ShouldRun reports true if the step should run after previous steps, failed or not.
+func (s Step) ShouldRun(failed bool) bool {
+	switch s.When {
+	case WhenFailure:
+		return failed
+	case WhenAlways:
+		return true
+	default:
+		return !failed
+	}
+}
+
+// StepList returns steps of the template with defaults.
+// Without steps, they are init and exec.
+func (t Template) StepList() []Step {
+	steps := t.Steps
+	if len(steps) == 0 {
+		steps = []Step{
+			{Name: StepInit},
+			{Name: StepExec},
+		}
+	}
+
+	r := make([]Step, len(steps))
+	for i, s := range steps {
+		switch s.Name {
+		case StepInit:
+			if s.Run == "" {
+				s.Run = t.Init
+			}
+		case StepExec:
+			if s.Run == "" {
+				s.Run = t.Exec
+			}
+			if s.Stdio == "" {
+				s.Stdio = StdioAttach
+			}
+		}
+		if s.Stdio == "" {
+			s.Stdio = StdioStderr
+		}
+		if s.When == "" {
+			s.When = WhenSuccess
+		}
+		r[i] = s
+	}
+	return r
+}
@@ -4,9 +4,9 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"path/filepath"
+	"strings"
 	"text/template"
-
-	"github.com/Masterminds/sprig"
 )
 
 var (
@@ -20,6 +20,35 @@ type Template struct {
 	Init   string   `json:"init" yaml:"init"`
 	Exec   string   `json:"exec" yaml:"exec"`
 	Main   string   `json:"main" yaml:"main"`
+	Lang   string   `json:"lang" yaml:"lang"`
+	Deps   []string `json:"deps" yaml:"deps"`
+	// Macros are additional macros, name to value.
+	Macros map[string]string `json:"macros" yaml:"macros"`
+	// ExpandScript enables macro expansion in the script.
+	ExpandScript bool `json:"expandScript" yaml:"expandScript"`
+	// Files are auxiliary files in the directory of the script, filename to template.
+	Files map[string]string `json:"files" yaml:"files"`
+	// Extends is a builtin template name or a template filename to inherit.
+	Extends string `json:"extends" yaml:"extends"`
+	// Steps are the lifecycle of the script, default is init and exec.
+	Steps []Step `json:"steps" yaml:"steps"`
+	// Shell executes steps, separated by spaces like "bash -euo pipefail", default is sh.
+	Shell string `json:"shell" yaml:"shell"`
+	// Env is additional environment variables of steps.
+	// Values can refer to environment variables like $HOME.
+	Env map[string]string `json:"env" yaml:"env"`
+	// Cwd is the working directory of the exec step, src (default) or exec.
+	Cwd string `json:"cwd" yaml:"cwd"`
+	// Check is a script command to check the generated script, text/template and macros are available.
+	Check string `json:"check" yaml:"check"`
+	// Fmt is a script command to format the generated script from stdin to stdout, applied by --dry --fmt.
+	// text/template and macros are available.
+	Fmt string `json:"fmt" yaml:"fmt"`
+	// Binary is a script command to build the executable @BINARY by export --binary.
+	// text/template and macros are available.
+	Binary string `json:"binary" yaml:"binary"`
+	// TabWidth converts tabs in the indentation of INIT, MAP and REDUCE into spaces if positive.
+	TabWidth int `json:"tabWidth" yaml:"tabWidth"`
 }
 
 func (t *Template) Override(
@@ -46,6 +75,37 @@ func (t Template) Validate() error {
 	if t.Main == "" {
 		return fmt.Errorf("%w: no main", ErrInvalidTemplate)
 	}
+	if len(t.Deps) > 0 && t.Lang == "" {
+		return fmt.Errorf("%w: deps without lang", ErrInvalidTemplate)
+	}
+	for k := range t.Files {
+		if k == "" || filepath.IsAbs(k) || !filepath.IsLocal(k) || k == t.Main {
+			return fmt.Errorf("%w: invalid file: %q", ErrInvalidTemplate, k)
+		}
+	}
+	if err := ValidateCwd(t.Cwd); err != nil {
+		return err
+	}
+	for k := range t.Env {
+		if k == "" || strings.ContainsAny(k, "=\x00") {
+			return fmt.Errorf("%w: invalid env: %q", ErrInvalidTemplate, k)
+		}
+	}
+	names := map[string]bool{}
+	for _, s := range t.StepList() {
+		if err := s.Validate(); err != nil {
+			return err
+		}
+		if names[s.Name] {
+			return fmt.Errorf("%w: duplicated step: %s", ErrInvalidTemplate, s.Name)
+		}
+		names[s.Name] = true
+	}
+	for k := range t.Macros {
+		if err := ValidateMacroName(k); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidTemplate, err)
+		}
+	}
 	return nil
 }
 
@@ -54,12 +114,81 @@ type ScriptArgs struct {
 	Map    string   `json:"map" yaml:"map"`
 	Reduce string   `json:"reduce" yaml:"reduce"`
 	Import []string `json:"import" yaml:"import"`
+	Dep    []string `json:"dep" yaml:"dep"`
+	Args   []string `json:"args" yaml:"args"`
+}
+
+// escapeMacros returns a copy of the arguments with @ escaped as @@ not to be replaced as macros.
+func (a *ScriptArgs) escapeMacros() *ScriptArgs {
+	if a == nil {
+		return nil
+	}
+	escape := func(s string) string {
+		return strings.ReplaceAll(s, "@", "@@")
+	}
+	escapeAll := func(xs []string) []string {
+		if xs == nil {
+			return nil
+		}
+		r := make([]string, len(xs))
+		for i, x := range xs {
+			r[i] = escape(x)
+		}
+		return r
+	}
+	return &ScriptArgs{
+		Init:   escape(a.Init),
+		Map:    escape(a.Map),
+		Reduce: escape(a.Reduce),
+		Import: escapeAll(a.Import),
+		Dep:    escapeAll(a.Dep),
+		Args:   escapeAll(a.Args),
+	}
 }
 
+// Execute renders the script.
 func (t Template) Execute(w io.Writer, args *ScriptArgs) error {
-	x, err := template.New(t.Name).Funcs(sprig.FuncMap()).Parse(t.Script)
+	return t.execute(w, t.Name, t.Script, args)
+}
+
+// ShellCommand returns the shell that executes steps.
+func (t Template) ShellCommand() []string {
+	if x := strings.Fields(t.Shell); len(x) > 0 {
+		return x
+	}
+	return []string{"sh"}
+}
+
+// ExecuteStep renders the script command of the step.
+func (t Template) ExecuteStep(w io.Writer, step Step, args *ScriptArgs) error {
+	return t.execute(w, t.Name+":"+step.Name, step.Run, args)
+}
+
+// ExecuteFile renders the auxiliary file.
+func (t Template) ExecuteFile(w io.Writer, name string, args *ScriptArgs) error {
+	return t.execute(w, t.Name+":"+name, t.Files[name], args)
+}
+
+func (t Template) execute(w io.Writer, name, text string, args *ScriptArgs) error {
+	return t.render(w, name, text, t.normalize(args))
+}
+
+func (Template) render(w io.Writer, name, text string, args *ScriptArgs) error {
+	x, err := template.New(name).Funcs(funcMap()).Parse(text)
 	if err != nil {
 		return err
 	}
 	return x.Execute(w, args)
 }
+
+// normalize normalizes the indentation of INIT, MAP and REDUCE.
+func (t Template) normalize(args *ScriptArgs) *ScriptArgs {
+	if args == nil {
+		return nil
+	}
+	x := *args
+	x.Init = NormalizeCode(x.Init, t.TabWidth)
+	x.Map = NormalizeCode(x.Map, t.TabWidth)
+	x.Reduce = NormalizeCode(x.Reduce, t.TabWidth)
+	return &x
+}
@@ -0,0 +1,103 @@
+package linep
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+var (
+	ErrUntrusted = errors.New("Untrusted")
+)
+
+// trustMarker returns the file that marks the content of the file name as trusted.
+func trustMarker(workDir, name string, content []byte) (string, error) {
+	x, err := filepath.Abs(name)
+	if err != nil {
+		return "", err
+	}
+	h, err := trustHash(name, content)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(workDir, "trust", HashString(x+"\x00"+h)), nil
+}
+
+// trustHash returns a hash of the content of the file name and the templates in its template-path,
+// not to run changed templates without trust.
+// Other files like template-patch and the templates of extends are not included.
+func trustHash(name string, content []byte) (string, error) {
+	files := map[string][]byte{
+		name: content,
+	}
+	c, err := parseConfigFile(name, content)
+	if err != nil {
+		// reported by reading the file
+		return HashFiles(files), nil
+	}
+	v, ok := c.Values["template-path"]
+	if !ok {
+		return HashFiles(files), nil
+	}
+	var dirs []string
+	switch v := resolvePaths(v, c.dir).(type) {
+	case string:
+		dirs = []string{v}
+	case []any:
+		for _, x := range v {
+			dirs = append(dirs, fmt.Sprint(x))
+		}
+	}
+	for _, dir := range dirs {
+		xs, err := os.ReadDir(dir)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		for _, x := range xs {
+			if ext := filepath.Ext(x.Name()); !x.Type().IsRegular() || (ext != ".yml" && ext != ".yaml") {
+				continue
+			}
+			p := filepath.Join(dir, x.Name())
+			b, err := os.ReadFile(p)
+			if err != nil {
+				return "", err
+			}
+			files[p] = b
+		}
+	}
+	return HashFiles(files), nil
+}
+
+// IsTrusted reports true if the content of the file name is trusted in workDir.
+func IsTrusted(workDir, name string, content []byte) (bool, error) {
+	x, err := trustMarker(workDir, name, content)
+	if err != nil {
+		return false, err
+	}
+	_, err = os.Stat(x)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Trust marks the current content of the file name as trusted in workDir.
+// The file should be trusted again after it is changed.
+func Trust(workDir, name string) error {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	x, err := trustMarker(workDir, name, b)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(x), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(x, []byte(name+"\n"), 0644)
+}
@@ -0,0 +1,64 @@
+package linep_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/berquerant/linep"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrust(t *testing.T) {
+	var (
+		workDir = t.TempDir()
+		name    = filepath.Join(t.TempDir(), linep.ProjectFileName)
+	)
+	if !assert.Nil(t, os.WriteFile(name, []byte("quiet: true\n"), 0644)) {
+		return
+	}
+
+	_, err := linep.ReadProjectFile(workDir, name)
+	assert.ErrorIs(t, err, linep.ErrUntrusted)
+
+	assert.Nil(t, linep.Trust(workDir, name))
+	got, err := linep.ReadProjectFile(workDir, name)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]any{"quiet": true}, got.Values)
+
+	t.Run("changed", func(t *testing.T) {
+		if !assert.Nil(t, os.WriteFile(name, []byte("quiet: false\n"), 0644)) {
+			return
+		}
+		_, err := linep.ReadProjectFile(workDir, name)
+		assert.ErrorIs(t, err, linep.ErrUntrusted)
+	})
+}
+
+func TestTrustTemplatePath(t *testing.T) {
+	var (
+		workDir = t.TempDir()
+		dir     = t.TempDir()
+		name    = filepath.Join(dir, linep.ProjectFileName)
+		tmpl    = filepath.Join(dir, "templates", "x.yml")
+	)
+	if !assert.Nil(t, os.WriteFile(name, []byte("template-path:\n  - templates\n"), 0644)) {
+		return
+	}
+	if !assert.Nil(t, os.MkdirAll(filepath.Dir(tmpl), 0755)) {
+		return
+	}
+	if !assert.Nil(t, os.WriteFile(tmpl, []byte("exec: echo x\n"), 0644)) {
+		return
+	}
+
+	assert.Nil(t, linep.Trust(workDir, name))
+	_, err := linep.ReadProjectFile(workDir, name)
+	assert.Nil(t, err)
+
+	if !assert.Nil(t, os.WriteFile(tmpl, []byte("exec: echo y\n"), 0644)) {
+		return
+	}
+	_, err = linep.ReadProjectFile(workDir, name)
+	assert.ErrorIs(t, err, linep.ErrUntrusted)
+}